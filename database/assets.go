@@ -0,0 +1,281 @@
+package database
+
+import (
+	"context"
+	"minna-style-hub/locale"
+	models "minna-style-hub/model"
+	"regexp"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	assetsCollectionName         = "assets"
+	pendingUploadsCollectionName = "pending_uploads"
+)
+
+// assetReferencePattern finds the ids of assets mentioned in a document, such as image
+// URLs, cover images and images embedded in Markdown text
+var assetReferencePattern = regexp.MustCompile(`/assets/([0-9a-f]{24})`)
+
+// AddAsset stores the metadata of an uploaded file
+func AddAsset(asset models.Asset) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(assetsCollectionName)
+
+	_, err := collection.InsertOne(ctx, asset)
+	return err
+}
+
+// GetAsset retrieves the metadata of an uploaded file by its id
+func GetAsset(id string) (models.Asset, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(assetsCollectionName)
+
+	var asset models.Asset
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&asset)
+	return asset, err
+}
+
+// ExistingAssetIDs returns the subset of ids that belong to stored assets
+func ExistingAssetIDs(ids []string) (map[string]bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(assetsCollectionName)
+
+	existing := make(map[string]bool, len(ids))
+	if len(ids) == 0 {
+		return existing, nil
+	}
+
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID string `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		existing[doc.ID] = true
+	}
+	return existing, cursor.Err()
+}
+
+// GetAssetsByIDs retrieves the assets with the given ids keyed by id
+func GetAssetsByIDs(ids []string) (map[string]models.Asset, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(assetsCollectionName)
+
+	assets := make(map[string]models.Asset, len(ids))
+	if len(ids) == 0 {
+		return assets, nil
+	}
+
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var asset models.Asset
+		if err := cursor.Decode(&asset); err != nil {
+			return nil, err
+		}
+		assets[asset.ID] = asset
+	}
+	return assets, cursor.Err()
+}
+
+// SetAssetVariants stores the resized variants generated for an asset
+func SetAssetVariants(id string, variants []models.AssetVariant) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(assetsCollectionName)
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"variants": variants}})
+	return err
+}
+
+// SetAssetPlaceholder stores the dominant colour and blurhash computed for an asset
+func SetAssetPlaceholder(id, dominantColor, blurhash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(assetsCollectionName)
+
+	update := bson.M{"$set": bson.M{"dominantColor": dominantColor, "blurhash": blurhash}}
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// StreamAssets calls fn for every stored asset, oldest first
+func StreamAssets(ctx context.Context, fn func(models.Asset) error) error {
+	collection := client.Database(databaseName).Collection(assetsCollectionName)
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := collection.Find(ctx, bson.M{}, findOptions)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var asset models.Asset
+		if err := cursor.Decode(&asset); err != nil {
+			return err
+		}
+		if err := fn(asset); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// MarkAssetsUnreferenced records at as the time the assets with the given ids were found
+// unreferenced, keeping any earlier time
+func MarkAssetsUnreferenced(ctx context.Context, ids []string, at time.Time) error {
+	collection := client.Database(databaseName).Collection(assetsCollectionName)
+
+	filter := bson.M{"_id": bson.M{"$in": ids}, "unreferencedAt": bson.M{"$exists": false}}
+	_, err := collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"unreferencedAt": at}})
+	return err
+}
+
+// ClearAssetsUnreferenced forgets when the assets with the given ids were found unreferenced
+func ClearAssetsUnreferenced(ctx context.Context, ids []string) error {
+	collection := client.Database(databaseName).Collection(assetsCollectionName)
+
+	filter := bson.M{"_id": bson.M{"$in": ids}, "unreferencedAt": bson.M{"$exists": true}}
+	_, err := collection.UpdateMany(ctx, filter, bson.M{"$unset": bson.M{"unreferencedAt": ""}})
+	return err
+}
+
+// ReferencedAssetIDs returns the ids of the assets mentioned by any item or collection.
+// Only the fields that may hold an asset URL are loaded, see assetReferenceFields.
+func ReferencedAssetIDs(ctx context.Context) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+	for name, fields := range assetReferenceFields() {
+		collection := client.Database(databaseName).Collection(name)
+
+		projection := bson.M{"_id": 0}
+		for _, field := range fields {
+			projection[field] = 1
+		}
+		cursor, err := collection.Find(ctx, bson.M{}, options.Find().SetProjection(projection))
+		if err != nil {
+			return nil, err
+		}
+		for cursor.Next(ctx) {
+			for _, match := range assetReferencePattern.FindAllSubmatch(cursor.Current, -1) {
+				referenced[string(match[1])] = true
+			}
+		}
+		err = cursor.Err()
+		cursor.Close(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return referenced, nil
+}
+
+// AssetReferenced reports whether any item or collection mentions the asset with the given id
+func AssetReferenced(ctx context.Context, id string) (bool, error) {
+	pattern := primitive.Regex{Pattern: "/assets/" + regexp.QuoteMeta(id)}
+	for name, fields := range assetReferenceFields() {
+		collection := client.Database(databaseName).Collection(name)
+
+		var conditions []bson.M
+		for _, field := range fields {
+			conditions = append(conditions, bson.M{field: pattern})
+		}
+		// Images stored as documents are matched through their URL
+		if name == collectionName {
+			conditions = append(conditions, bson.M{"images.url": pattern})
+		}
+		count, err := collection.CountDocuments(ctx, bson.M{"$or": conditions}, options.Count().SetLimit(1))
+		if err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// assetReferenceFields lists per collection the fields that may hold asset URLs: images,
+// cover images and Markdown text with embedded images
+func assetReferenceFields() map[string][]string {
+	itemFields := []string{"images", "text"}
+	for _, loc := range locale.Supported {
+		itemFields = append(itemFields, "translations."+loc+".text")
+	}
+	return map[string][]string{
+		collectionName:            itemFields,
+		collectionsCollectionName: {"coverImage", "description"},
+	}
+}
+
+// DeleteAsset removes the metadata of an asset
+func DeleteAsset(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(assetsCollectionName)
+
+	_, err := collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// AddPendingUpload stores an upload that was handed a presigned URL
+func AddPendingUpload(upload models.PendingUpload) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(pendingUploadsCollectionName)
+
+	_, err := collection.InsertOne(ctx, upload)
+	return err
+}
+
+// GetPendingUpload retrieves a pending upload that has not expired yet
+func GetPendingUpload(id string) (models.PendingUpload, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(pendingUploadsCollectionName)
+
+	// The TTL monitor only runs once a minute, so expiry is checked here as well
+	var upload models.PendingUpload
+	err := collection.FindOne(ctx, bson.M{"_id": id, "expiresAt": bson.M{"$gt": time.Now().UTC()}}).Decode(&upload)
+	return upload, err
+}
+
+// DeletePendingUpload removes a pending upload once it has been completed
+func DeletePendingUpload(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(pendingUploadsCollectionName)
+
+	_, err := collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	models "minna-style-hub/model"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var attributeSchemasCollectionName = "attribute_schemas"
+
+// categoryCollation matches categories case-insensitively, like sortCollation
+var categoryCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// GetAttributeSchemas retrieves all attribute schemas ordered by category
+func GetAttributeSchemas() ([]models.AttributeSchema, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(attributeSchemasCollectionName)
+
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "category", Value: 1}}).
+		SetCollation(categoryCollation)
+	cursor, err := collection.Find(ctx, bson.M{}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	schemas := []models.AttributeSchema{}
+	if err := cursor.All(ctx, &schemas); err != nil {
+		return nil, err
+	}
+	return schemas, nil
+}
+
+// GetAttributeSchema retrieves an attribute schema by its id
+func GetAttributeSchema(id string) (models.AttributeSchema, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(attributeSchemasCollectionName)
+
+	var schema models.AttributeSchema
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&schema)
+	return schema, err
+}
+
+// GetCategoryAttributeSchema retrieves the attribute schema of a category, matched
+// case-insensitively. It returns nil when the category has no schema.
+func GetCategoryAttributeSchema(category string) (*models.AttributeSchema, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(attributeSchemasCollectionName)
+
+	var schema models.AttributeSchema
+	findOptions := options.FindOne().SetCollation(categoryCollation)
+	err := collection.FindOne(ctx, bson.M{"category": category}, findOptions).Decode(&schema)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// AddAttributeSchema adds a new attribute schema. Adding a second schema for a category
+// fails with a duplicate key error.
+func AddAttributeSchema(schema models.AttributeSchema) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(attributeSchemasCollectionName)
+
+	_, err := collection.InsertOne(ctx, schema)
+	return err
+}
+
+// UpdateAttributeSchema replaces an existing attribute schema. Items are validated against
+// the schema when they are written, so existing items are not checked again.
+func UpdateAttributeSchema(schema models.AttributeSchema) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(attributeSchemasCollectionName)
+
+	_, err := collection.ReplaceOne(ctx, bson.M{"_id": schema.ID}, schema)
+	return err
+}
+
+// DeleteAttributeSchema deletes an attribute schema by its id
+func DeleteAttributeSchema(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(attributeSchemasCollectionName)
+
+	_, err := collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
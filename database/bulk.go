@@ -0,0 +1,186 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Bulk operation types
+const (
+	BulkSet       = "set"
+	BulkAddTag    = "addTag"
+	BulkRemoveTag = "removeTag"
+	BulkDelete    = "delete"
+	BulkSetStatus = "setStatus"
+)
+
+// Per-item bulk result statuses
+const (
+	BulkResultOK       = "ok"
+	BulkResultNotFound = "not_found"
+	BulkResultFailed   = "failed"
+)
+
+// BulkOperation describes the change applied to every targeted item
+type BulkOperation struct {
+	Type   string                 `json:"type"`
+	Fields map[string]interface{} `json:"fields,omitempty"`
+	Tag    string                 `json:"tag,omitempty"`
+	Status string                 `json:"status,omitempty"`
+}
+
+// BulkItemResult reports the outcome of a bulk operation for a single item
+type BulkItemResult struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// FindItemIDs returns the ids of the items matching the filter
+func FindItemIDs(filter ItemFilter) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	findOptions := options.Find().SetProjection(bson.M{"_id": 1})
+	cursor, err := collection.Find(ctx, filter.BSON(), findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []struct {
+		ID string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+	}
+	return ids, nil
+}
+
+// ExistingItemIDs returns the subset of ids that belong to stored items
+func ExistingItemIDs(ids []string) (map[string]bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	findOptions := options.Find().SetProjection(bson.M{"_id": 1})
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	existing := make(map[string]bool, len(ids))
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID string `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		existing[doc.ID] = true
+	}
+	return existing, cursor.Err()
+}
+
+// bulkWriteModel builds the write model applying op to the item with the given id
+func bulkWriteModel(id string, op BulkOperation, now time.Time) mongo.WriteModel {
+	filter := bson.M{"_id": id}
+
+	if op.Type == BulkDelete {
+		return mongo.NewDeleteOneModel().SetFilter(filter)
+	}
+
+	set := bson.M{"updatedAt": now}
+	update := bson.M{"$set": set}
+	switch op.Type {
+	case BulkAddTag:
+		update["$addToSet"] = bson.M{"tags": op.Tag}
+	case BulkRemoveTag:
+		update["$pull"] = bson.M{"tags": op.Tag}
+	case BulkSetStatus:
+		set["status"] = op.Status
+	default:
+		for field, value := range op.Fields {
+			set[field] = value
+		}
+	}
+	return mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update)
+}
+
+// BulkApplyToItems executes op against the given item ids with a single unordered BulkWrite
+// and reports the outcome for each id. Ids that do not exist are reported as not found.
+func BulkApplyToItems(ids []string, op BulkOperation) ([]BulkItemResult, error) {
+	existing, err := ExistingItemIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	results := make([]BulkItemResult, len(ids))
+	var models []mongo.WriteModel
+	var modelIndex []int // position in results of each write model
+	for i, id := range ids {
+		results[i] = BulkItemResult{ID: id, Status: BulkResultOK}
+		if !existing[id] {
+			results[i].Status = BulkResultNotFound
+			continue
+		}
+		models = append(models, bulkWriteModel(id, op, now))
+		modelIndex = append(modelIndex, i)
+	}
+
+	if len(models) == 0 {
+		return results, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	_, err = collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		var bulkErr mongo.BulkWriteException
+		if !errors.As(err, &bulkErr) {
+			return nil, err
+		}
+		for _, writeErr := range bulkErr.WriteErrors {
+			if writeErr.Index < 0 || writeErr.Index >= len(modelIndex) {
+				continue
+			}
+			result := &results[modelIndex[writeErr.Index]]
+			result.Status = BulkResultFailed
+			result.Error = writeErr.Message
+		}
+	}
+
+	if op.Type == BulkDelete {
+		var deleted []string
+		for _, result := range results {
+			if result.Status == BulkResultOK {
+				deleted = append(deleted, result.ID)
+			}
+		}
+		if len(deleted) > 0 {
+			if err := cleanupDeletedItems(ctx, deleted); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	models "minna-style-hub/model"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var clicksCollectionName = "clicks"
+
+// Click count groupings
+const (
+	ClicksByItem  = "item"
+	ClicksByBrand = "brand"
+	ClicksByDay   = "day"
+)
+
+// clickSaltSettingID is the id of the settings document holding the generated click hash salt
+const clickSaltSettingID = "clickHashSalt"
+
+// ClickHashSalt returns the salt IP addresses of clicks are hashed with, storing salt as
+// the salt when none is stored yet. Every instance thus agrees on the first salt stored.
+func ClickHashSalt(salt string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(settingsCollectionName)
+
+	update := bson.M{"$setOnInsert": bson.M{"salt": salt}}
+	findOptions := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var setting struct {
+		Salt string `bson:"salt"`
+	}
+	err := collection.FindOneAndUpdate(ctx, bson.M{"_id": clickSaltSettingID}, update, findOptions).Decode(&setting)
+	return setting.Salt, err
+}
+
+// AddClick stores an outbound click
+func AddClick(click models.Click) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(clicksCollectionName)
+
+	_, err := collection.InsertOne(ctx, click)
+	return err
+}
+
+// CountClicks aggregates clicks between from and to (either may be zero) per item, brand or day.
+// Results are ordered by count, or chronologically when grouping by day.
+func CountClicks(groupBy string, from, to time.Time) ([]models.ClickCount, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(clicksCollectionName)
+
+	var key interface{}
+	sort := bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}
+	switch groupBy {
+	case ClicksByItem:
+		key = "$itemId"
+	case ClicksByBrand:
+		key = "$brand"
+	case ClicksByDay:
+		key = bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$timestamp"}}
+		sort = bson.D{{Key: "_id", Value: 1}}
+	default:
+		return nil, fmt.Errorf("unknown click grouping %q", groupBy)
+	}
+
+	match := bson.M{}
+	timestamp := bson.M{}
+	if !from.IsZero() {
+		timestamp["$gte"] = from
+	}
+	if !to.IsZero() {
+		timestamp["$lt"] = to
+	}
+	if len(timestamp) > 0 {
+		match["timestamp"] = timestamp
+	}
+
+	pipeline := []bson.M{
+		{"$match": match},
+		{"$group": bson.M{"_id": key, "count": bson.M{"$sum": 1}}},
+		{"$sort": sort},
+	}
+	if groupBy == ClicksByItem {
+		// Attach the item title so the report is readable without a second request
+		pipeline = append(pipeline,
+			bson.M{"$lookup": bson.M{
+				"from":         collectionName,
+				"localField":   "_id",
+				"foreignField": "_id",
+				"as":           "item",
+			}},
+			bson.M{"$set": bson.M{"title": bson.M{"$first": "$item.title"}}},
+			bson.M{"$unset": "item"},
+		)
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	counts := []models.ClickCount{}
+	if err := cursor.All(ctx, &counts); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"context"
+	models "minna-style-hub/model"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var collectionsCollectionName = "collections"
+
+// GetCollections retrieves all collections, optionally only those with the given status
+func GetCollections(status string) ([]models.Collection, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(collectionsCollectionName)
+
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	collections := []models.Collection{}
+	if err := cursor.All(ctx, &collections); err != nil {
+		return nil, err
+	}
+	return collections, nil
+}
+
+// GetCollection retrieves a collection by its id or slug
+func GetCollection(idOrSlug string) (models.Collection, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(collectionsCollectionName)
+
+	var result models.Collection
+	filter := bson.M{"$or": []bson.M{{"_id": idOrSlug}, {"slug": idOrSlug}}}
+	err := collection.FindOne(ctx, filter).Decode(&result)
+	return result, err
+}
+
+// AddCollection adds a new collection to the database
+func AddCollection(c models.Collection) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(collectionsCollectionName)
+
+	_, err := collection.InsertOne(ctx, c)
+	return err
+}
+
+// UpdateCollection replaces the editable fields of a collection
+func UpdateCollection(c models.Collection) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(collectionsCollectionName)
+
+	update := bson.M{
+		"$set": bson.M{
+			"title":       c.Title,
+			"slug":        c.Slug,
+			"description": c.Description,
+			"coverImage":  c.CoverImage,
+			"itemIds":     c.ItemIDs,
+			"status":      c.Status,
+		},
+	}
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": c.ID}, update)
+	return err
+}
+
+// DeleteCollection deletes a collection by its id
+func DeleteCollection(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(collectionsCollectionName)
+
+	_, err := collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// UniqueCollectionSlug derives a slug from title that no other collection uses
+func UniqueCollectionSlug(title, excludeID string) (string, error) {
+	collection := client.Database(databaseName).Collection(collectionsCollectionName)
+	return uniqueSlug(collection, title, "collection", excludeID)
+}
+
+// CollectionSlugAvailable reports whether the slug is free for the collection with the given id
+func CollectionSlugAvailable(candidate, id string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(collectionsCollectionName)
+
+	taken, err := slugTaken(ctx, collection, candidate, id)
+	return !taken, err
+}
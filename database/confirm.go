@@ -0,0 +1,78 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// confirmResendInterval is how long after a confirmation email no other is sent for the
+// same subscription, so subscribing repeatedly cannot flood someone else's inbox
+const confirmResendInterval = time.Hour
+
+// claimConfirmationEmail records that a confirmation email is about to be sent for the
+// unconfirmed subscription id in collectionName. claimed is false when the subscription
+// is confirmed already or its last confirmation email is recent.
+func claimConfirmationEmail(collectionName, id string) (claimed bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	now := time.Now().UTC()
+	filter := bson.M{
+		"_id":         id,
+		"confirmedAt": bson.M{"$exists": false},
+		"$or": []bson.M{
+			{"confirmSentAt": bson.M{"$exists": false}},
+			{"confirmSentAt": bson.M{"$lt": now.Add(-confirmResendInterval)}},
+		},
+	}
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"confirmSentAt": now}})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// releaseConfirmationEmail lets the confirmation email of a subscription be sent again
+// right away, used when sending it failed
+func releaseConfirmationEmail(collectionName, id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$unset": bson.M{"confirmSentAt": ""}})
+	return err
+}
+
+// confirmSubscription marks the subscription with the given token in collectionName as
+// confirmed, applying set as well. Confirming twice is not an error. found is false when
+// no subscription has the token.
+func confirmSubscription(collectionName, token string, set, unset bson.M) (found bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	set["confirmedAt"] = time.Now().UTC()
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	result, err := collection.UpdateOne(ctx, bson.M{"token": token, "confirmedAt": bson.M{"$exists": false}}, update)
+	if err != nil {
+		return false, err
+	}
+	if result.MatchedCount > 0 {
+		return true, nil
+	}
+
+	count, err := collection.CountDocuments(ctx, bson.M{"token": token})
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	models "minna-style-hub/model"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// exportBatchSize controls how many documents the cursor fetches per round trip
+const exportBatchSize = 200
+
+// StreamItems walks every item matching the filter straight from a MongoDB cursor
+// and hands them to fn one at a time, so the whole collection is never held in memory.
+// When fields is not empty only those fields (plus _id) are loaded.
+func StreamItems(ctx context.Context, filter ItemFilter, fields []string, fn func(models.Item) error) error {
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	findOptions := options.Find()
+	findOptions.SetBatchSize(exportBatchSize)
+	findOptions.SetSort(bson.D{{Key: "_id", Value: 1}})
+	if len(fields) > 0 {
+		projection := bson.M{}
+		for _, field := range fields {
+			// Untagged fields are stored lowercased on insert but camelCased by UpdateItem
+			projection[field] = 1
+			projection[strings.ToLower(field)] = 1
+		}
+		findOptions.SetProjection(projection)
+	}
+
+	cursor, err := collection.Find(ctx, filter.BSON(), findOptions)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var item models.Item
+		if err := cursor.Decode(&item); err != nil {
+			return err
+		}
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
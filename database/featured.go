@@ -0,0 +1,167 @@
+package database
+
+import (
+	"context"
+	models "minna-style-hub/model"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const settingsCollectionName = "settings"
+
+// featuredSettingID is the id of the settings document holding the featured ordering
+const featuredSettingID = "featured"
+
+// featuredOrder is the ordered list of featured item ids. Keeping the whole ordering in
+// one document means a reorder replaces it in a single atomic write.
+type featuredOrder struct {
+	ID        string    `bson:"_id"`
+	ItemIDs   []string  `bson:"itemIds"`
+	UpdatedAt time.Time `bson:"updatedAt"`
+}
+
+// featuredItemIDs returns the ids of the published featured items in order, or nil when
+// none are. Items that were deleted or are not published are left out, so the items after
+// them move up and featured positions have no gaps.
+func featuredItemIDs(ctx context.Context) ([]string, error) {
+	collection := client.Database(databaseName).Collection(settingsCollectionName)
+
+	var order featuredOrder
+	err := collection.FindOne(ctx, bson.M{"_id": featuredSettingID}).Decode(&order)
+	if err == mongo.ErrNoDocuments || (err == nil && len(order.ItemIDs) == 0) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	items := client.Database(databaseName).Collection(collectionName)
+	query := bson.M{"_id": bson.M{"$in": order.ItemIDs}, "status": bson.M{"$in": publishedStatuses}}
+	cursor, err := items.Find(ctx, query, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	published := make(map[string]bool, len(order.ItemIDs))
+	for cursor.Next(ctx) {
+		var item struct {
+			ID string `bson:"_id"`
+		}
+		if err := cursor.Decode(&item); err != nil {
+			return nil, err
+		}
+		published[item.ID] = true
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, id := range order.ItemIDs {
+		if published[id] {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// featuredItems returns the featured items matching the filter in featured order
+func featuredItems(ctx context.Context, filter ItemFilter, ids []string) ([]models.Item, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	query := filter.BSON()
+	query["_id"] = bson.M{"$in": ids}
+	cursor, err := collection.Find(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	byID := make(map[string]models.Item, len(ids))
+	for cursor.Next(ctx) {
+		var item models.Item
+		if err := cursor.Decode(&item); err != nil {
+			return nil, err
+		}
+		byID[item.ID] = item
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	items := make([]models.Item, 0, len(byID))
+	for _, id := range ids {
+		if item, ok := byID[id]; ok {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// markFeatured sets Featured and FeaturedPosition on the items found in ids
+func markFeatured(items []models.Item, ids []string) {
+	positions := make(map[string]int, len(ids))
+	for i, id := range ids {
+		positions[id] = i + 1
+	}
+	for i := range items {
+		if position, ok := positions[items[i].ID]; ok {
+			items[i].Featured = true
+			items[i].FeaturedPosition = position
+		}
+	}
+}
+
+// GetFeaturedItems returns the published featured items matching the filter in featured order
+func GetFeaturedItems(filter ItemFilter) ([]models.Item, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ids, err := featuredItemIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	items, err := featuredItems(ctx, filter, ids)
+	if err != nil {
+		return nil, err
+	}
+	markFeatured(items, ids)
+	return items, nil
+}
+
+// SetFeaturedItems replaces the featured ordering with ids. The ordering is stored in a
+// single document, so readers see either the old or the new ordering, never a mix.
+func SetFeaturedItems(ids []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(settingsCollectionName)
+
+	if ids == nil {
+		ids = []string{}
+	}
+	order := featuredOrder{
+		ID:        featuredSettingID,
+		ItemIDs:   ids,
+		UpdatedAt: time.Now().UTC(),
+	}
+	_, err := collection.ReplaceOne(ctx, bson.M{"_id": featuredSettingID}, order, options.Replace().SetUpsert(true))
+	return err
+}
+
+// removeFeaturedItems drops deleted items from the featured ordering
+func removeFeaturedItems(ctx context.Context, ids []string) error {
+	collection := client.Database(databaseName).Collection(settingsCollectionName)
+
+	update := bson.M{"$pull": bson.M{"itemIds": bson.M{"$in": ids}}}
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": featuredSettingID}, update)
+	return err
+}
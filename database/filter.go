@@ -0,0 +1,95 @@
+package database
+
+import (
+	models "minna-style-hub/model"
+	"regexp"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ItemFilter holds the optional filters shared by item listings and exports
+type ItemFilter struct {
+	Brand    string
+	Query    string
+	Tag      string
+	Status   string
+	Category string
+	// Attributes maps attribute names to the values an item may have, any of them matches
+	Attributes map[string][]string
+	// PublishedOnly leaves out drafts and archived items, for listings visitors see
+	PublishedOnly bool
+}
+
+// publishedStatuses are the stored statuses of items visitors may see. Items saved before
+// statuses existed have none and count as published.
+var publishedStatuses = bson.A{nil, "", models.StatusPublished}
+
+// IsEmpty reports whether no filter has been set
+func (f ItemFilter) IsEmpty() bool {
+	return f.Brand == "" && f.Query == "" && f.Tag == "" && f.Status == "" && f.Category == "" && len(f.Attributes) == 0
+}
+
+// BSON converts the filter into a MongoDB query document
+func (f ItemFilter) BSON() bson.M {
+	filter := bson.M{}
+
+	if f.Brand != "" {
+		// Brands are matched exactly but case-insensitively
+		filter["brand"] = bson.M{"$regex": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(f.Brand) + "$", Options: "i"}}
+	}
+
+	if f.Tag != "" {
+		filter["tags"] = f.Tag
+	}
+
+	switch {
+	case f.PublishedOnly && f.Status != "" && f.Status != models.StatusPublished:
+		// Visitors asking for drafts find nothing
+		filter["status"] = bson.M{"$in": bson.A{}}
+	case f.PublishedOnly:
+		filter["status"] = bson.M{"$in": publishedStatuses}
+	case f.Status != "":
+		filter["status"] = f.Status
+	}
+
+	if f.Category != "" {
+		// Matched regardless of case like attribute schemas, for items saved before
+		// categories were normalized
+		filter["category"] = bson.M{"$regex": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(f.Category) + "$", Options: "i"}}
+	}
+
+	for name, values := range f.Attributes {
+		if !models.ValidAttributeName(name) || len(values) == 0 {
+			continue
+		}
+		filter["attributes."+name] = bson.M{"$in": attributeCandidates(values)}
+	}
+
+	if f.Query != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(f.Query), Options: "i"}
+		filter["$or"] = []bson.M{
+			{"title": bson.M{"$regex": pattern}},
+			{"brand": bson.M{"$regex": pattern}},
+		}
+	}
+
+	return filter
+}
+
+// attributeCandidates converts attribute values from a query string into the values they may
+// be stored as: numbers and booleans are matched in their typed form as well as as text
+func attributeCandidates(values []string) []interface{} {
+	candidates := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		candidates = append(candidates, value)
+		if number, err := strconv.ParseFloat(value, 64); err == nil {
+			candidates = append(candidates, number)
+		}
+		if flag, err := strconv.ParseBool(value); err == nil {
+			candidates = append(candidates, flag)
+		}
+	}
+	return candidates
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"log"
+	models "minna-style-hub/model"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// BackfillImages rewrites the images of items stored as plain URL strings into image
+// documents. Strings are still read correctly, this keeps the stored shape uniform.
+func BackfillImages() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	// Matches arrays holding at least one string
+	filter := bson.M{"images": bson.M{"$type": "string"}}
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	count := 0
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID     string         `bson:"_id"`
+			Images []models.Image `bson:"images"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": doc.ID}, bson.M{"$set": bson.M{"images": doc.Images}}); err != nil {
+			return err
+		}
+		count++
+	}
+
+	if count > 0 {
+		log.Printf("Backfilled structured images for %d items", count)
+	}
+	return cursor.Err()
+}
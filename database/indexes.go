@@ -0,0 +1,191 @@
+package database
+
+import (
+	"context"
+	"minna-style-hub/locale"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// uniqueSlugIndex is a unique index on slug that ignores documents without one
+func uniqueSlugIndex() mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys: bson.D{{Key: "slug", Value: 1}},
+		Options: options.Index().
+			SetName("slug_unique").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"slug": bson.M{"$gt": ""}}),
+	}
+}
+
+// Weights of the item fields in text search relevance
+const (
+	titleWeight = 10
+	brandWeight = 5
+	tagsWeight  = 3
+	textWeight  = 1
+)
+
+// textSearchIndex is the text index SearchItems ranks results with. The translations of
+// every supported locale are indexed with the weight of the field they translate. Items
+// are written in several languages, so words are matched as they are, without stemming
+// or stop words of one language.
+func textSearchIndex() mongo.IndexModel {
+	keys := bson.D{
+		{Key: "title", Value: "text"},
+		{Key: "brand", Value: "text"},
+		{Key: "tags", Value: "text"},
+		{Key: "text", Value: "text"},
+	}
+	weights := bson.D{
+		{Key: "title", Value: titleWeight},
+		{Key: "brand", Value: brandWeight},
+		{Key: "tags", Value: tagsWeight},
+		{Key: "text", Value: textWeight},
+	}
+	for _, loc := range locale.Supported {
+		keys = append(keys,
+			bson.E{Key: "translations." + loc + ".title", Value: "text"},
+			bson.E{Key: "translations." + loc + ".text", Value: "text"})
+		weights = append(weights,
+			bson.E{Key: "translations." + loc + ".title", Value: titleWeight},
+			bson.E{Key: "translations." + loc + ".text", Value: textWeight})
+	}
+
+	return mongo.IndexModel{
+		Keys: keys,
+		Options: options.Index().
+			SetName("text_search").
+			SetWeights(weights).
+			SetDefaultLanguage("none"),
+	}
+}
+
+// EnsureIndexes creates the indexes the application relies on. Creating an
+// index that already exists with the same definition is a no-op in MongoDB.
+func EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	indexes := map[string][]mongo.IndexModel{
+		collectionName: {
+			uniqueSlugIndex(),
+			{
+				Keys:    bson.D{{Key: "slugHistory", Value: 1}},
+				Options: options.Index().SetName("slug_history"),
+			},
+			{
+				Keys:    bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}},
+				Options: options.Index().SetName("created"),
+			},
+			textSearchIndex(),
+		},
+		attributeSchemasCollectionName: {
+			{
+				Keys: bson.D{{Key: "category", Value: 1}},
+				Options: options.Index().
+					SetName("category_unique").
+					SetUnique(true).
+					SetCollation(categoryCollation),
+			},
+		},
+		clicksCollectionName: {
+			{
+				Keys:    bson.D{{Key: "itemId", Value: 1}, {Key: "timestamp", Value: 1}},
+				Options: options.Index().SetName("item_timestamp"),
+			},
+			{
+				Keys:    bson.D{{Key: "timestamp", Value: 1}},
+				Options: options.Index().SetName("timestamp"),
+			},
+		},
+		collectionsCollectionName: {
+			uniqueSlugIndex(),
+		},
+		reviewsCollectionName: {
+			{
+				Keys:    bson.D{{Key: "itemId", Value: 1}, {Key: "status", Value: 1}, {Key: "createdAt", Value: -1}},
+				Options: options.Index().SetName("item_status_created"),
+			},
+			{
+				Keys:    bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: -1}},
+				Options: options.Index().SetName("status_created"),
+			},
+		},
+		pendingUploadsCollectionName: {
+			{
+				// MongoDB deletes pending uploads that were never completed
+				Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+				Options: options.Index().SetName("expires_ttl").SetExpireAfterSeconds(0),
+			},
+		},
+		priceHistoryCollectionName: {
+			{
+				Keys:    bson.D{{Key: "itemId", Value: 1}, {Key: "changedAt", Value: 1}},
+				Options: options.Index().SetName("item_changed"),
+			},
+		},
+		priceAlertsCollectionName: {
+			{
+				Keys:    bson.D{{Key: "itemId", Value: 1}, {Key: "email", Value: 1}},
+				Options: options.Index().SetName("item_email_unique").SetUnique(true),
+			},
+			{
+				Keys:    bson.D{{Key: "token", Value: 1}},
+				Options: options.Index().SetName("token_unique").SetUnique(true),
+			},
+			{
+				// MongoDB deletes alerts that were not confirmed in time
+				Keys:    bson.D{{Key: "confirmBy", Value: 1}},
+				Options: options.Index().SetName("confirm_by_ttl").SetExpireAfterSeconds(0),
+			},
+		},
+		stockSubscriptionsCollectionName: {
+			{
+				Keys:    bson.D{{Key: "itemId", Value: 1}, {Key: "email", Value: 1}},
+				Options: options.Index().SetName("item_email_unique").SetUnique(true),
+			},
+			{
+				Keys:    bson.D{{Key: "token", Value: 1}},
+				Options: options.Index().SetName("token_unique").SetUnique(true),
+			},
+			{
+				Keys:    bson.D{{Key: "queuedAt", Value: 1}},
+				Options: options.Index().SetName("queued").SetSparse(true),
+			},
+			{
+				// MongoDB deletes subscriptions once expiresAt has passed
+				Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+				Options: options.Index().SetName("expires_ttl").SetExpireAfterSeconds(0),
+			},
+		},
+		wishlistsCollectionName: {
+			{
+				Keys:    bson.D{{Key: "owner", Value: 1}, {Key: "createdAt", Value: 1}},
+				Options: options.Index().SetName("owner_created"),
+			},
+			{
+				Keys: bson.D{{Key: "shareToken", Value: 1}},
+				Options: options.Index().
+					SetName("share_token_unique").
+					SetUnique(true).
+					SetPartialFilterExpression(bson.M{"shareToken": bson.M{"$gt": ""}}),
+			},
+			{
+				Keys:    bson.D{{Key: "itemIds", Value: 1}},
+				Options: options.Index().SetName("item_ids"),
+			},
+		},
+	}
+
+	for name, models := range indexes {
+		collection := client.Database(databaseName).Collection(name)
+		if _, err := collection.Indexes().CreateMany(ctx, models); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	models "minna-style-hub/model"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SetItemLinkChecks stores the latest link check results of an item
+func SetItemLinkChecks(id string, checks []models.LinkCheck) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	update := bson.M{"$set": bson.M{"linkChecks": checks}}
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// GetItemsWithBrokenLinks retrieves the items whose last link check found at least one broken link
+func GetItemsWithBrokenLinks() ([]models.Item, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	findOptions := options.Find().
+		SetProjection(bson.M{"title": 1, "brand": 1, "slug": 1, "linkChecks": 1}).
+		SetSort(bson.D{{Key: "brand", Value: 1}, {Key: "title", Value: 1}})
+
+	cursor, err := collection.Find(ctx, bson.M{"linkChecks.ok": false}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	items := []models.Item{}
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	"log"
+	"minna-style-hub/markdown"
+	models "minna-style-hub/model"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// BackfillTextHTML renders and stores the HTML text of items written before
+// Markdown rendering existed
+func BackfillTextHTML() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	filter := bson.M{
+		"text":     bson.M{"$gt": ""},
+		"textHtml": bson.M{"$exists": false},
+	}
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	count := 0
+	for cursor.Next(ctx) {
+		var item models.Item
+		if err := cursor.Decode(&item); err != nil {
+			return err
+		}
+		if err := markdown.RenderItem(&item); err != nil {
+			return err
+		}
+
+		update := bson.M{"$set": bson.M{
+			"textHtml":     item.TextHTML,
+			"translations": item.Translations,
+		}}
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": item.ID}, update); err != nil {
+			return err
+		}
+		count++
+	}
+
+	if count > 0 {
+		log.Printf("Rendered Markdown text for %d items", count)
+	}
+	return cursor.Err()
+}
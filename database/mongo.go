@@ -3,15 +3,23 @@ package database
 import (
 	"context"
 	"log"
+	"minna-style-hub/locale"
 	models "minna-style-hub/model"
 	"os"
+	"regexp"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
 )
 
 // MongoDB client
@@ -74,11 +82,18 @@ func AddItem(item models.Item) error {
 
 	collection := client.Database(databaseName).Collection(collectionName)
 
+	now := time.Now().UTC()
+	item.CreatedAt = now
+	item.UpdatedAt = now
+
 	_, err := collection.InsertOne(ctx, item)
 	if err != nil {
 		return err
 	}
 
+	if item.Price > 0 {
+		return recordPriceChange(ctx, item.ID, 0, item.Price, now)
+	}
 	return nil
 }
 
@@ -90,14 +105,25 @@ func UpdateItem(item models.Item) error {
 
 	collection := client.Database(databaseName).Collection(collectionName)
 
+	now := time.Now().UTC()
+
 	// Exclude _id field from update
 	update := bson.M{
 		"$set": bson.M{
-			"title":      item.Title,
-			"text":       item.Text,
-			"brand":      item.Brand,
-			"images":     item.Images,
-			"buttonLink": item.ButtonLink,
+			"title":        item.Title,
+			"text":         item.Text,
+			"textHtml":     item.TextHTML,
+			"brand":        item.Brand,
+			"images":       item.Images,
+			"buttonLink":   item.ButtonLink,
+			"tags":         item.Tags,
+			"status":       item.Status,
+			"category":     item.Category,
+			"price":        item.Price,
+			"outOfStock":   item.OutOfStock,
+			"attributes":   item.Attributes,
+			"updatedAt":    now,
+			"translations": item.Translations,
 			// Add other fields you want to update here
 		},
 	}
@@ -105,11 +131,23 @@ func UpdateItem(item models.Item) error {
 	// Use item.ID directly
 	filter := bson.M{"_id": item.ID}
 
-	_, err := collection.UpdateOne(ctx, filter, update)
+	// Read the previous price in the same operation so every price change is recorded
+	findOptions := options.FindOneAndUpdate().
+		SetReturnDocument(options.Before).
+		SetProjection(bson.M{"price": 1})
+
+	var previous models.Item
+	err := collection.FindOneAndUpdate(ctx, filter, update, findOptions).Decode(&previous)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
+	if previous.Price != item.Price {
+		return recordPriceChange(ctx, item.ID, previous.Price, item.Price, now)
+	}
 	return nil
 }
 
@@ -124,9 +162,35 @@ func DeleteItem(id string) error {
 		return err
 	}
 
+	if err := cleanupDeletedItems(ctx, []string{id}); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// cleanupDeletedItems removes data that only makes sense while the items exist:
+// wishlist entries, related pins, featured entries, price history and alerts, stock
+// subscriptions and reviews
+func cleanupDeletedItems(ctx context.Context, ids []string) error {
+	if err := removeItemsFromWishlists(ctx, ids); err != nil {
+		return err
+	}
+	if err := removeRelatedPins(ctx, ids); err != nil {
+		return err
+	}
+	if err := removeFeaturedItems(ctx, ids); err != nil {
+		return err
+	}
+	if err := deleteItemPrices(ctx, ids); err != nil {
+		return err
+	}
+	if err := deleteItemStockSubscriptions(ctx, ids); err != nil {
+		return err
+	}
+	return deleteItemReviews(ctx, ids)
+}
+
 func GetItem(id string) (models.Item, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -149,61 +213,221 @@ func GetItem(id string) (models.Item, error) {
 }
 
 
-// GetItemsWithPagination retrieves items from the database with pagination
-func GetItemsWithPagination(offset, limit int) ([]models.Item, error) {
+// GetItemsWithPagination retrieves items matching the filter from the database with pagination.
+// With pinFeatured, published featured items come first in their featured order, followed by
+// the other items; without it featured items keep their place in the sort. Items are ordered by one of
+// the sort orders in itemSorts or in natural order when sort is empty.
+func GetItemsWithPagination(filter ItemFilter, sort string, pinFeatured bool, offset, limit int) ([]models.Item, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	collection := client.Database(databaseName).Collection(collectionName)
 
-	findOptions := options.Find()
-	findOptions.SetSkip(int64(offset))
-	findOptions.SetLimit(int64(limit))
-
-	cursor, err := collection.Find(ctx, bson.M{}, findOptions)
+	// Featured ids are needed to mark the featured items even when they are not pinned
+	featuredIDs, err := featuredItemIDs(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(ctx)
+	var featured []models.Item
+	if pinFeatured {
+		featured, err = featuredItems(ctx, filter, featuredIDs)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	var items []models.Item
-	if err := cursor.All(ctx, &items); err != nil {
-		return nil, err
+	if offset < len(featured) {
+		end := offset + limit
+		if end > len(featured) {
+			end = len(featured)
+		}
+		items = append(items, featured[offset:end]...)
+	}
+
+	restOffset := offset - len(featured)
+	if restOffset < 0 {
+		restOffset = 0
 	}
+	restLimit := limit - len(items)
+	if restLimit > 0 {
+		query := filter.BSON()
+		if pinFeatured && len(featuredIDs) > 0 {
+			query = bson.M{"$and": []bson.M{query, {"_id": bson.M{"$nin": featuredIDs}}}}
+		}
+
+		findOptions := options.Find()
+		findOptions.SetSkip(int64(restOffset))
+		findOptions.SetLimit(int64(restLimit))
+		applyItemSort(findOptions, sort)
+
+		cursor, err := collection.Find(ctx, query, findOptions)
+		if err != nil {
+			return nil, err
+		}
+		defer cursor.Close(ctx)
+
+		var rest []models.Item
+		if err := cursor.All(ctx, &rest); err != nil {
+			return nil, err
+		}
+		items = append(items, rest...)
+	}
+
+	markFeatured(items, featuredIDs)
 	return items, nil
 }
 
 
-// GetTotalItemCount retrieves the total count of items from the database
-func GetTotalItemCount() (int, error) {
+// GetTotalItemCount retrieves the total count of items matching the filter from the database
+func GetTotalItemCount(filter ItemFilter) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	collection := client.Database(databaseName).Collection(collectionName)
 
-	totalCount, err := collection.CountDocuments(ctx, bson.M{})
+	totalCount, err := collection.CountDocuments(ctx, filter.BSON())
 	if err != nil {
 		return 0, err
 	}
 	return int(totalCount), nil
 }
 
-// SearchItems performs a search for items matching the query
-func SearchItems(query string) ([]models.Item, error) {
+// minTextQueryLength is the length from which queries use the text index
+const minTextQueryLength = 3
+
+// SearchItems performs a search for items matching the query. The text index matches the
+// words of the query in the title, brand, tags and text and their translations, and Score
+// of each result is its weighted relevance. Only published items are found, and only those
+// whose content in the given locale
+// contains a word of the query are kept, so a Swedish title does not match an English
+// search. Results are ordered by relevance unless sort names another order, see
+// GetItemsWithPagination. Shorter queries, and those whose words match nothing, such as
+// the start of a word, are matched as a substring of the title in the given locale and
+// the brand, and have no score.
+func SearchItems(query, loc, sort string) ([]models.Item, error) {
     ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
     defer cancel()
 
     collection := client.Database(databaseName).Collection(collectionName)
 
+    if utf8.RuneCountInString(strings.TrimSpace(query)) < minTextQueryLength {
+        return searchItemsBySubstring(ctx, collection, query, loc, sort)
+    }
+
+    filter := bson.M{"$text": bson.M{"$search": query}, "status": bson.M{"$in": publishedStatuses}}
+
+    findOptions := options.Find()
+    findOptions.SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}})
+    if order, ok := itemSorts[sort]; ok {
+        // Text queries only support the simple collation, so no case-insensitive sorting here
+        findOptions.SetSort(order)
+    } else {
+        findOptions.SetSort(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}, {Key: "_id", Value: 1}})
+    }
+
+    cursor, err := collection.Find(ctx, filter, findOptions)
+    if err != nil {
+        return nil, err
+    }
+    defer cursor.Close(ctx)
+
+    var results []struct {
+        models.Item `bson:",inline"`
+        Score       float64 `bson:"score"`
+    }
+    if err := cursor.All(ctx, &results); err != nil {
+        return nil, err
+    }
+
+    terms := textQueryTerms(query)
+    var items []models.Item
+    for _, result := range results {
+        if !matchesInLocale(result.Item, terms, loc) {
+            continue
+        }
+        item := result.Item
+        item.Score = result.Score
+        items = append(items, item)
+    }
+    if len(items) == 0 {
+        return searchItemsBySubstring(ctx, collection, query, loc, sort)
+    }
+    return items, nil
+}
+
+// textQueryTerms returns the lower-cased words of a text search query, leaving out the
+// words the query excludes with a leading minus
+func textQueryTerms(query string) []string {
+    var terms []string
+    for _, field := range strings.Fields(query) {
+        if strings.HasPrefix(field, "-") {
+            continue
+        }
+        terms = append(terms, searchWords(field)...)
+    }
+    return terms
+}
+
+// searchWords splits s into lower-cased words without diacritics, the way the text index
+// compares them
+func searchWords(s string) []string {
+    folded, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), s)
+    if err != nil {
+        folded = s
+    }
+    return strings.FieldsFunc(strings.ToLower(folded), func(r rune) bool {
+        return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+    })
+}
+
+// matchesInLocale reports whether a word of terms occurs in the title, text, brand or
+// tags of the item as shown in loc. The text index also covers the other translations,
+// which would otherwise match.
+func matchesInLocale(item models.Item, terms []string, loc string) bool {
+    locale.Localize(&item, loc)
+    fields := append([]string{item.Title, item.Text, item.Brand}, item.Tags...)
+
+    words := make(map[string]bool)
+    for _, field := range fields {
+        for _, word := range searchWords(field) {
+            words[word] = true
+        }
+    }
+    for _, term := range terms {
+        if words[term] {
+            return true
+        }
+    }
+    return false
+}
+
+// searchItemsBySubstring matches query anywhere in the title and brand. Text search only
+// matches whole words, so queries too short to be one are searched this way instead.
+func searchItemsBySubstring(ctx context.Context, collection *mongo.Collection, query, loc, sort string) ([]models.Item, error) {
+    pattern := primitive.Regex{Pattern: regexp.QuoteMeta(strings.TrimSpace(query)), Options: "i"}
+
     // Define a filter for searching
     filter := bson.M{
+        "status": bson.M{"$in": publishedStatuses},
         "$or": []bson.M{
-            {"title": bson.M{"$regex": primitive.Regex{Pattern: query, Options: "i"}}},
-            {"brand": bson.M{"$regex": primitive.Regex{Pattern: query, Options: "i"}}},
+            {"title": bson.M{"$regex": pattern}},
+            {"brand": bson.M{"$regex": pattern}},
         },
     }
+    if loc != "" && loc != locale.Default {
+        translatedTitle := "translations." + loc + ".title"
+        filter["$or"] = []bson.M{
+            {translatedTitle: bson.M{"$regex": pattern}},
+            {translatedTitle: bson.M{"$in": []interface{}{nil, ""}}, "title": bson.M{"$regex": pattern}},
+            {"brand": bson.M{"$regex": pattern}},
+        }
+    }
+
+    findOptions := options.Find()
+    applyItemSort(findOptions, sort)
 
-    cursor, err := collection.Find(ctx, filter)
+    cursor, err := collection.Find(ctx, filter, findOptions)
     if err != nil {
         return nil, err
     }
@@ -215,3 +439,57 @@ func SearchItems(query string) ([]models.Item, error) {
     }
     return items, nil
 }
+
+// GetItemsByIDs retrieves the items with the given ids in the order of ids.
+// Ids without a matching item are skipped.
+func GetItemsByIDs(ids []string) ([]models.Item, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var found []models.Item
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]models.Item, len(found))
+	for _, item := range found {
+		byID[item.ID] = item
+	}
+
+	items := make([]models.Item, 0, len(ids))
+	for _, id := range ids {
+		if item, ok := byID[id]; ok {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// removeRelatedPins drops deleted items from the related pins of the other items
+func removeRelatedPins(ctx context.Context, ids []string) error {
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	filter := bson.M{"relatedPins": bson.M{"$in": ids}}
+	update := bson.M{"$pull": bson.M{"relatedPins": bson.M{"$in": ids}}}
+	_, err := collection.UpdateMany(ctx, filter, update)
+	return err
+}
+
+// SetRelatedPins stores the manually pinned related items of an item
+func SetRelatedPins(id string, pins []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"relatedPins": pins}})
+	return err
+}
@@ -0,0 +1,210 @@
+package database
+
+import (
+	"context"
+	models "minna-style-hub/model"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var priceHistoryCollectionName = "price_history"
+var priceAlertsCollectionName = "price_alerts"
+
+// recordPriceChange appends a price change of an item to its price history
+func recordPriceChange(ctx context.Context, itemID string, oldPrice, price float64, changedAt time.Time) error {
+	collection := client.Database(databaseName).Collection(priceHistoryCollectionName)
+
+	change := models.PriceChange{
+		ID:        primitive.NewObjectID().Hex(),
+		ItemID:    itemID,
+		OldPrice:  oldPrice,
+		Price:     price,
+		ChangedAt: changedAt,
+	}
+	_, err := collection.InsertOne(ctx, change)
+	return err
+}
+
+// GetPriceHistory retrieves the price changes of an item, oldest first, and the total number of changes
+func GetPriceHistory(itemID string, offset, limit int) ([]models.PriceChange, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(priceHistoryCollectionName)
+
+	filter := bson.M{"itemId": itemID}
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "changedAt", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	changes := []models.PriceChange{}
+	if err := cursor.All(ctx, &changes); err != nil {
+		return nil, 0, err
+	}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	return changes, int(total), nil
+}
+
+// SavePriceAlert subscribes an email address to price drops of an item. Subscribing again
+// before confirming updates the threshold and gives the alert a new deadline; a confirmed
+// alert is left as it is, as anyone may know the address, see SetPriceAlertThreshold.
+// The stored alert is returned, including the token of an existing subscription.
+// alert.ConfirmBy is when the alert is deleted unless it is confirmed.
+func SavePriceAlert(alert models.PriceAlert) (models.PriceAlert, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(priceAlertsCollectionName)
+
+	filter := bson.M{"itemId": alert.ItemID, "email": alert.Email}
+	unconfirmed := bson.M{"itemId": alert.ItemID, "email": alert.Email, "confirmedAt": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"threshold": alert.Threshold, "confirmBy": alert.ConfirmBy}}
+	result, err := collection.UpdateOne(ctx, unconfirmed, update)
+	if err != nil {
+		return models.PriceAlert{}, err
+	}
+	if result.MatchedCount == 0 {
+		update := bson.M{"$setOnInsert": alert}
+		if _, err := collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+			return models.PriceAlert{}, err
+		}
+	}
+
+	var saved models.PriceAlert
+	err = collection.FindOne(ctx, filter).Decode(&saved)
+	return saved, err
+}
+
+// SetPriceAlertThreshold changes the threshold of the alert with the given token and arms
+// it again. found is false when no alert has the token.
+func SetPriceAlertThreshold(token string, threshold float64) (found bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(priceAlertsCollectionName)
+
+	update := bson.M{
+		"$set":   bson.M{"threshold": threshold},
+		"$unset": bson.M{"notifiedAt": ""},
+	}
+	result, err := collection.UpdateOne(ctx, bson.M{"token": token}, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// ConfirmPriceAlert arms the alert with the given token.
+// found is false when no alert has the token.
+func ConfirmPriceAlert(token string) (found bool, err error) {
+	return confirmSubscription(priceAlertsCollectionName, token, bson.M{}, bson.M{"confirmBy": "", "confirmSentAt": ""})
+}
+
+// ClaimPriceAlertConfirmationEmail records that the confirmation email of an unconfirmed
+// alert is about to be sent. claimed is false when it must not be sent now.
+func ClaimPriceAlertConfirmationEmail(id string) (claimed bool, err error) {
+	return claimConfirmationEmail(priceAlertsCollectionName, id)
+}
+
+// ReleasePriceAlertConfirmationEmail allows resending a confirmation email that could not be sent
+func ReleasePriceAlertConfirmationEmail(id string) error {
+	return releaseConfirmationEmail(priceAlertsCollectionName, id)
+}
+
+// DeletePriceAlert removes the alert with the given unsubscribe token.
+// found is false when no alert has the token.
+func DeletePriceAlert(token string) (found bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(priceAlertsCollectionName)
+
+	result, err := collection.DeleteOne(ctx, bson.M{"token": token})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// RearmPriceAlerts makes alerts of an item whose threshold the price reached again fire on the next drop
+func RearmPriceAlerts(itemID string, price float64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(priceAlertsCollectionName)
+
+	filter := bson.M{
+		"itemId":     itemID,
+		"threshold":  bson.M{"$lte": price},
+		"notifiedAt": bson.M{"$exists": true},
+	}
+	_, err := collection.UpdateMany(ctx, filter, bson.M{"$unset": bson.M{"notifiedAt": ""}})
+	return err
+}
+
+// ClaimPriceAlert marks the next armed, confirmed alert of an item whose threshold is above price as
+// notified and returns it, so concurrent senders never email the same subscriber twice.
+// found is false when no alert is due.
+func ClaimPriceAlert(itemID string, price float64) (alert models.PriceAlert, found bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(priceAlertsCollectionName)
+
+	filter := bson.M{
+		"itemId":      itemID,
+		"threshold":   bson.M{"$gt": price},
+		"confirmedAt": bson.M{"$exists": true},
+		"notifiedAt":  bson.M{"$exists": false},
+	}
+	update := bson.M{"$set": bson.M{"notifiedAt": time.Now().UTC()}}
+
+	err = collection.FindOneAndUpdate(ctx, filter, update).Decode(&alert)
+	if err == mongo.ErrNoDocuments {
+		return alert, false, nil
+	}
+	if err != nil {
+		return alert, false, err
+	}
+	return alert, true, nil
+}
+
+// ReleasePriceAlert arms a claimed alert again, used when its email could not be sent
+func ReleasePriceAlert(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(priceAlertsCollectionName)
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$unset": bson.M{"notifiedAt": ""}})
+	return err
+}
+
+// deleteItemPrices removes the price history and price alerts of deleted items
+func deleteItemPrices(ctx context.Context, ids []string) error {
+	filter := bson.M{"itemId": bson.M{"$in": ids}}
+
+	history := client.Database(databaseName).Collection(priceHistoryCollectionName)
+	if _, err := history.DeleteMany(ctx, filter); err != nil {
+		return err
+	}
+
+	alerts := client.Database(databaseName).Collection(priceAlertsCollectionName)
+	_, err := alerts.DeleteMany(ctx, filter)
+	return err
+}
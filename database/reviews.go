@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"math"
+	models "minna-style-hub/model"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var reviewsCollectionName = "reviews"
+
+// AddReview stores a new review
+func AddReview(review models.Review) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(reviewsCollectionName)
+
+	_, err := collection.InsertOne(ctx, review)
+	return err
+}
+
+// GetReview retrieves a review by its id
+func GetReview(id string) (models.Review, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(reviewsCollectionName)
+
+	var review models.Review
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&review)
+	return review, err
+}
+
+// GetReviews retrieves reviews, newest first, filtered by item and/or status when those are not empty.
+// It also returns the total number of matching reviews.
+func GetReviews(itemID, status string, offset, limit int) ([]models.Review, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(reviewsCollectionName)
+
+	filter := bson.M{}
+	if itemID != "" {
+		filter["itemId"] = itemID
+	}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	reviews := []models.Review{}
+	if err := cursor.All(ctx, &reviews); err != nil {
+		return nil, 0, err
+	}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	return reviews, int(total), nil
+}
+
+// ModerateReview sets the status of a review and refreshes the rating of its item
+func ModerateReview(review models.Review, status string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(reviewsCollectionName)
+
+	update := bson.M{"$set": bson.M{"status": status, "moderatedAt": time.Now().UTC()}}
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": review.ID}, update); err != nil {
+		return err
+	}
+	return refreshItemRating(ctx, review.ItemID)
+}
+
+// DeleteReview deletes a review and refreshes the rating of its item
+func DeleteReview(review models.Review) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(reviewsCollectionName)
+
+	if _, err := collection.DeleteOne(ctx, bson.M{"_id": review.ID}); err != nil {
+		return err
+	}
+	return refreshItemRating(ctx, review.ItemID)
+}
+
+// refreshItemRating recomputes the average rating and review count stored on an item
+// from its approved reviews
+func refreshItemRating(ctx context.Context, itemID string) error {
+	reviews := client.Database(databaseName).Collection(reviewsCollectionName)
+	items := client.Database(databaseName).Collection(collectionName)
+
+	pipeline := []bson.M{
+		{"$match": bson.M{"itemId": itemID, "status": models.ReviewApproved}},
+		{"$group": bson.M{"_id": nil, "rating": bson.M{"$avg": "$rating"}, "count": bson.M{"$sum": 1}}},
+	}
+	cursor, err := reviews.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var stats []struct {
+		Rating float64 `bson:"rating"`
+		Count  int     `bson:"count"`
+	}
+	if err := cursor.All(ctx, &stats); err != nil {
+		return err
+	}
+
+	update := bson.M{"$unset": bson.M{"rating": "", "reviewCount": ""}}
+	if len(stats) > 0 && stats[0].Count > 0 {
+		update = bson.M{"$set": bson.M{
+			"rating":      math.Round(stats[0].Rating*100) / 100,
+			"reviewCount": stats[0].Count,
+		}}
+	}
+
+	_, err = items.UpdateOne(ctx, bson.M{"_id": itemID}, update)
+	return err
+}
+
+// deleteItemReviews removes the reviews of deleted items
+func deleteItemReviews(ctx context.Context, itemIDs []string) error {
+	collection := client.Database(databaseName).Collection(reviewsCollectionName)
+
+	_, err := collection.DeleteMany(ctx, bson.M{"itemId": bson.M{"$in": itemIDs}})
+	return err
+}
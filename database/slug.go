@@ -0,0 +1,169 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	models "minna-style-hub/model"
+	"minna-style-hub/slug"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxSlugAttempts bounds the numeric suffixes tried when a slug is taken
+const maxSlugAttempts = 100
+
+// slugTaken reports whether a document other than excludeID in coll already uses the slug,
+// either now or as a previous slug that old links are still redirected from
+func slugTaken(ctx context.Context, coll *mongo.Collection, candidate, excludeID string) (bool, error) {
+	filter := bson.M{"$or": []bson.M{
+		{"slug": candidate},
+		{"slugHistory": candidate},
+	}}
+	if excludeID != "" {
+		filter["_id"] = bson.M{"$ne": excludeID}
+	}
+	count, err := coll.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// uniqueSlug derives a slug from title that no other document in coll uses, appending
+// -2, -3, ... when needed. fallback is used for titles without any usable characters.
+func uniqueSlug(coll *mongo.Collection, title, fallback, excludeID string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	base := slug.Make(title)
+	if base == "" {
+		base = fallback
+	}
+
+	for i := 1; i <= maxSlugAttempts; i++ {
+		candidate := slug.WithSuffix(base, i)
+
+		taken, err := slugTaken(ctx, coll, candidate, excludeID)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no free slug found for %q", title)
+}
+
+// UniqueSlug derives a slug from title that no other item uses.
+// The item with excludeID (if any) is ignored so it can keep its own slug.
+func UniqueSlug(title, excludeID string) (string, error) {
+	collection := client.Database(databaseName).Collection(collectionName)
+	return uniqueSlug(collection, title, "item", excludeID)
+}
+
+// SlugAvailable reports whether the slug is free for the item with the given id
+func SlugAvailable(candidate, id string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	taken, err := slugTaken(ctx, collection, candidate, id)
+	return !taken, err
+}
+
+// GetItemBySlug looks an item up by its current slug, falling back to the slug history.
+// redirected is true when the slug only matched a previous slug of the item.
+func GetItemBySlug(value string) (item models.Item, redirected bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	err = collection.FindOne(ctx, bson.M{"slug": value}).Decode(&item)
+	if err == nil {
+		return item, false, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return models.Item{}, false, err
+	}
+
+	err = collection.FindOne(ctx, bson.M{"slugHistory": value}).Decode(&item)
+	if err != nil {
+		return models.Item{}, false, err
+	}
+	return item, true, nil
+}
+
+// SetItemSlug replaces the slug of an item and keeps the previous one in its history,
+// so links using the old slug can be redirected. manual marks slugs chosen by an admin,
+// which are no longer regenerated when the title changes.
+func SetItemSlug(item models.Item, newSlug string, manual bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	history := make([]string, 0, len(item.SlugHistory)+1)
+	for _, old := range item.SlugHistory {
+		if old != newSlug && old != item.Slug {
+			history = append(history, old)
+		}
+	}
+	if item.Slug != "" && item.Slug != newSlug {
+		history = append(history, item.Slug)
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"slug":        newSlug,
+			"slugHistory": history,
+			"slugManual":  manual,
+		},
+	}
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": item.ID}, update)
+	return err
+}
+
+// BackfillSlugs gives every item without a slug one generated from its title
+func BackfillSlugs() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	filter := bson.M{"$or": []bson.M{
+		{"slug": bson.M{"$exists": false}},
+		{"slug": ""},
+	}}
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var items []models.Item
+	if err := cursor.All(ctx, &items); err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		newSlug, err := UniqueSlug(item.Title, item.ID)
+		if err != nil {
+			return err
+		}
+		if err := SetItemSlug(item, newSlug, false); err != nil {
+			return err
+		}
+	}
+
+	if len(items) > 0 {
+		log.Printf("Generated slugs for %d items", len(items))
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Item sort orders accepted by GetItemsWithPagination and SearchItems
+const (
+	SortNewest = "newest"
+	SortOldest = "oldest"
+	SortTitle  = "title"
+	SortBrand  = "brand"
+	SortPrice  = "price"
+	SortRating = "rating"
+	// SortRelevance orders search results by text score, it is only accepted by SearchItems
+	SortRelevance = "relevance"
+)
+
+// itemSorts maps each sort order to its MongoDB sort document. _id is always
+// the last key so pages stay stable between requests.
+var itemSorts = map[string]bson.D{
+	SortNewest: {{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}},
+	SortOldest: {{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}},
+	SortTitle:  {{Key: "title", Value: 1}, {Key: "_id", Value: 1}},
+	SortBrand:  {{Key: "brand", Value: 1}, {Key: "title", Value: 1}, {Key: "_id", Value: 1}},
+	SortPrice:  {{Key: "price", Value: 1}, {Key: "_id", Value: 1}},
+	SortRating: {{Key: "rating", Value: -1}, {Key: "reviewCount", Value: -1}, {Key: "_id", Value: 1}},
+}
+
+// sortCollation compares strings case-insensitively so "acne" and "Acne" sort together
+var sortCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// ValidItemSort reports whether sort is empty (natural order) or a known sort order
+func ValidItemSort(sort string) bool {
+	if sort == "" {
+		return true
+	}
+	_, ok := itemSorts[sort]
+	return ok
+}
+
+// applyItemSort sets the sort order on findOptions, leaving natural order for an empty sort
+func applyItemSort(findOptions *options.FindOptions, sort string) {
+	order, ok := itemSorts[sort]
+	if !ok {
+		return
+	}
+	findOptions.SetSort(order)
+	findOptions.SetCollation(sortCollation)
+}
@@ -0,0 +1,203 @@
+package database
+
+import (
+	"context"
+	models "minna-style-hub/model"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var stockSubscriptionsCollectionName = "stock_subscriptions"
+
+// stockClaimTimeout is how long a claimed notification may stay unsent before another
+// sender picks it up again, e.g. after a crash
+const stockClaimTimeout = 10 * time.Minute
+
+// SaveStockSubscription subscribes an email address to the return of an item. Subscribing
+// again with the same address updates the existing subscription instead of adding another,
+// so every subscriber is emailed at most once. sub.ExpiresAt is the deadline for confirming;
+// an unconfirmed subscription gets the new deadline, while a confirmed one is left as it is,
+// as anyone may know the address.
+func SaveStockSubscription(sub models.StockSubscription) (models.StockSubscription, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(stockSubscriptionsCollectionName)
+
+	filter := bson.M{"itemId": sub.ItemID, "email": sub.Email}
+	update := bson.M{
+		"$setOnInsert": bson.M{
+			"_id":       sub.ID,
+			"token":     sub.Token,
+			"createdAt": sub.CreatedAt,
+			"expiresAt": sub.ExpiresAt,
+		},
+	}
+	findOptions := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var saved models.StockSubscription
+	if err := collection.FindOneAndUpdate(ctx, filter, update, findOptions).Decode(&saved); err != nil {
+		return saved, err
+	}
+	if saved.ConfirmedAt != nil {
+		return saved, nil
+	}
+
+	// Only extended while still unconfirmed, so one confirmed meanwhile keeps its lifetime
+	filter = bson.M{"_id": saved.ID, "confirmedAt": bson.M{"$exists": false}}
+	if _, err := collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"expiresAt": sub.ExpiresAt}}); err != nil {
+		return saved, err
+	}
+	saved.ExpiresAt = sub.ExpiresAt
+	return saved, nil
+}
+
+// ConfirmStockSubscription activates the subscription with the given token, which then
+// lasts for ttl. found is false when no subscription has the token.
+func ConfirmStockSubscription(token string, ttl time.Duration) (found bool, err error) {
+	set := bson.M{"expiresAt": time.Now().UTC().Add(ttl)}
+	return confirmSubscription(stockSubscriptionsCollectionName, token, set, bson.M{"confirmSentAt": ""})
+}
+
+// ClaimStockConfirmationEmail records that the confirmation email of an unconfirmed
+// subscription is about to be sent. claimed is false when it must not be sent now.
+func ClaimStockConfirmationEmail(id string) (claimed bool, err error) {
+	return claimConfirmationEmail(stockSubscriptionsCollectionName, id)
+}
+
+// ReleaseStockConfirmationEmail allows resending a confirmation email that could not be sent
+func ReleaseStockConfirmationEmail(id string) error {
+	return releaseConfirmationEmail(stockSubscriptionsCollectionName, id)
+}
+
+// DeleteStockSubscription removes the subscription with the given unsubscribe token.
+// found is false when no subscription has the token.
+func DeleteStockSubscription(token string) (found bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(stockSubscriptionsCollectionName)
+
+	result, err := collection.DeleteOne(ctx, bson.M{"token": token})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// QueueStockNotifications queues an email for every confirmed, unexpired subscription of an
+// item that is back in stock and returns how many were queued
+func QueueStockNotifications(itemID string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(stockSubscriptionsCollectionName)
+
+	now := time.Now().UTC()
+	filter := bson.M{
+		"itemId":      itemID,
+		"confirmedAt": bson.M{"$exists": true},
+		"expiresAt":   bson.M{"$gt": now},
+		"queuedAt":    bson.M{"$exists": false},
+	}
+	result, err := collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"queuedAt": now}})
+	if err != nil {
+		return 0, err
+	}
+	return int(result.ModifiedCount), nil
+}
+
+// ClaimStockNotification marks the oldest queued notification as being sent and returns it.
+// found is false when the queue is empty.
+func ClaimStockNotification() (sub models.StockSubscription, found bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(stockSubscriptionsCollectionName)
+
+	now := time.Now().UTC()
+	filter := bson.M{
+		"queuedAt":  bson.M{"$exists": true},
+		"expiresAt": bson.M{"$gt": now},
+		"$or": []bson.M{
+			{"claimedAt": bson.M{"$exists": false}},
+			{"claimedAt": bson.M{"$lt": now.Add(-stockClaimTimeout)}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"claimedAt": now}}
+	findOptions := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "queuedAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	err = collection.FindOneAndUpdate(ctx, filter, update, findOptions).Decode(&sub)
+	if err == mongo.ErrNoDocuments {
+		return sub, false, nil
+	}
+	if err != nil {
+		return sub, false, err
+	}
+	return sub, true, nil
+}
+
+// CompleteStockNotification removes a subscription whose notification was sent or is no longer needed
+func CompleteStockNotification(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(stockSubscriptionsCollectionName)
+
+	_, err := collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// UnqueueStockNotification returns a claimed notification to the waiting subscriptions,
+// used when the item ran out again before the email went out
+func UnqueueStockNotification(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(stockSubscriptionsCollectionName)
+
+	update := bson.M{"$unset": bson.M{"queuedAt": "", "claimedAt": "", "attempts": ""}}
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// FailStockNotification records a failed send so the notification is retried,
+// dropping it after maxAttempts failures
+func FailStockNotification(id string, maxAttempts int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(stockSubscriptionsCollectionName)
+
+	update := bson.M{
+		"$inc":   bson.M{"attempts": 1},
+		"$unset": bson.M{"claimedAt": ""},
+	}
+	findOptions := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var sub models.StockSubscription
+	err := collection.FindOneAndUpdate(ctx, bson.M{"_id": id}, update, findOptions).Decode(&sub)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if sub.Attempts >= maxAttempts {
+		_, err = collection.DeleteOne(ctx, bson.M{"_id": id})
+	}
+	return err
+}
+
+// deleteItemStockSubscriptions removes the stock subscriptions of deleted items
+func deleteItemStockSubscriptions(ctx context.Context, ids []string) error {
+	collection := client.Database(databaseName).Collection(stockSubscriptionsCollectionName)
+
+	_, err := collection.DeleteMany(ctx, bson.M{"itemId": bson.M{"$in": ids}})
+	return err
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BackfillTimestamps sets createdAt and updatedAt on items written before timestamps
+// existed, using the creation time encoded in their ObjectID hex id
+func BackfillTimestamps() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	filter := bson.M{"createdAt": bson.M{"$exists": false}}
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	count := 0
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID        string    `bson:"_id"`
+			UpdatedAt time.Time `bson:"updatedAt"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		objectID, err := primitive.ObjectIDFromHex(doc.ID)
+		if err != nil {
+			// Not an ObjectID, so there is no creation time to recover
+			continue
+		}
+
+		createdAt := objectID.Timestamp().UTC()
+		set := bson.M{"createdAt": createdAt}
+		if doc.UpdatedAt.IsZero() {
+			set["updatedAt"] = createdAt
+		}
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": doc.ID}, bson.M{"$set": set}); err != nil {
+			return err
+		}
+		count++
+	}
+
+	if count > 0 {
+		log.Printf("Backfilled timestamps for %d items", count)
+	}
+	return cursor.Err()
+}
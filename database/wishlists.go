@@ -0,0 +1,168 @@
+package database
+
+import (
+	"context"
+	models "minna-style-hub/model"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var wishlistsCollectionName = "wishlists"
+
+// GetWishlists retrieves the wishlists of an owner, oldest first
+func GetWishlists(owner string) ([]models.Wishlist, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(wishlistsCollectionName)
+
+	cursor, err := collection.Find(ctx, bson.M{"owner": owner}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	wishlists := []models.Wishlist{}
+	if err := cursor.All(ctx, &wishlists); err != nil {
+		return nil, err
+	}
+	return wishlists, nil
+}
+
+// CountWishlists returns how many wishlists an owner has
+func CountWishlists(owner string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(wishlistsCollectionName)
+
+	count, err := collection.CountDocuments(ctx, bson.M{"owner": owner})
+	return int(count), err
+}
+
+// GetWishlist retrieves a wishlist by id, only if it belongs to owner
+func GetWishlist(id, owner string) (models.Wishlist, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(wishlistsCollectionName)
+
+	var wishlist models.Wishlist
+	err := collection.FindOne(ctx, bson.M{"_id": id, "owner": owner}).Decode(&wishlist)
+	return wishlist, err
+}
+
+// GetSharedWishlist retrieves a wishlist by its share token
+func GetSharedWishlist(token string) (models.Wishlist, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(wishlistsCollectionName)
+
+	var wishlist models.Wishlist
+	err := collection.FindOne(ctx, bson.M{"shareToken": token}).Decode(&wishlist)
+	return wishlist, err
+}
+
+// AddWishlist stores a new wishlist
+func AddWishlist(wishlist models.Wishlist) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(wishlistsCollectionName)
+
+	_, err := collection.InsertOne(ctx, wishlist)
+	return err
+}
+
+// updateWishlist applies update to the wishlist of owner and reports whether it exists
+func updateWishlist(id, owner string, update bson.M) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(wishlistsCollectionName)
+
+	if _, ok := update["$set"]; !ok {
+		update["$set"] = bson.M{}
+	}
+	update["$set"].(bson.M)["updatedAt"] = time.Now().UTC()
+
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": id, "owner": owner}, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// RenameWishlist changes the name of a wishlist
+func RenameWishlist(id, owner, name string) (bool, error) {
+	return updateWishlist(id, owner, bson.M{"$set": bson.M{"name": name}})
+}
+
+// AddWishlistItem appends an item to a wishlist of owner unless it is already saved there.
+// The limit is part of the update filter, so concurrent requests cannot exceed it. added is
+// false when the wishlist does not exist or already holds maxItems other items.
+func AddWishlistItem(id, owner, itemID string, maxItems int) (added bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(wishlistsCollectionName)
+
+	filter := bson.M{
+		"_id":   id,
+		"owner": owner,
+		"$or": []bson.M{
+			{"itemIds": itemID},
+			{"itemIds." + strconv.Itoa(maxItems-1): bson.M{"$exists": false}},
+		},
+	}
+	update := bson.M{
+		"$addToSet": bson.M{"itemIds": itemID},
+		"$set":      bson.M{"updatedAt": time.Now().UTC()},
+	}
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// RemoveWishlistItem removes an item from a wishlist
+func RemoveWishlistItem(id, owner, itemID string) (bool, error) {
+	return updateWishlist(id, owner, bson.M{"$pull": bson.M{"itemIds": itemID}})
+}
+
+// SetWishlistShareToken sets or, with an empty token, revokes the public share token of a wishlist
+func SetWishlistShareToken(id, owner, token string) (bool, error) {
+	if token == "" {
+		return updateWishlist(id, owner, bson.M{"$unset": bson.M{"shareToken": ""}})
+	}
+	return updateWishlist(id, owner, bson.M{"$set": bson.M{"shareToken": token}})
+}
+
+// DeleteWishlist deletes a wishlist of owner
+func DeleteWishlist(id, owner string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := client.Database(databaseName).Collection(wishlistsCollectionName)
+
+	result, err := collection.DeleteOne(ctx, bson.M{"_id": id, "owner": owner})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// removeItemsFromWishlists drops deleted items from every wishlist
+func removeItemsFromWishlists(ctx context.Context, itemIDs []string) error {
+	collection := client.Database(databaseName).Collection(wishlistsCollectionName)
+
+	filter := bson.M{"itemIds": bson.M{"$in": itemIDs}}
+	update := bson.M{"$pull": bson.M{"itemIds": bson.M{"$in": itemIDs}}}
+	_, err := collection.UpdateMany(ctx, filter, update)
+	return err
+}
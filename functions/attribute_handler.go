@@ -0,0 +1,294 @@
+package functions
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"minna-style-hub/database"
+	models "minna-style-hub/model"
+	"minna-style-hub/validation"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxAttributeTextLength bounds the length of string attribute values
+const maxAttributeTextLength = 200
+
+// attributeFilterPrefix starts the query parameters that filter items by attribute
+const attributeFilterPrefix = "attr."
+
+// parseAttributeFilter reads the attr.<name>=<value> parameters of an item listing
+func parseAttributeFilter(query url.Values) map[string][]string {
+	attributes := make(map[string][]string)
+	for key, values := range query {
+		if strings.HasPrefix(key, attributeFilterPrefix) {
+			attributes[strings.TrimPrefix(key, attributeFilterPrefix)] = values
+		}
+	}
+	return cleanAttributeFilter(attributes)
+}
+
+// cleanAttributeFilter drops unusable attribute names and empty values, so a filter
+// that ends up empty is recognised as such by ItemFilter.IsEmpty
+func cleanAttributeFilter(attributes map[string][]string) map[string][]string {
+	var cleaned map[string][]string
+	for name, values := range attributes {
+		if !models.ValidAttributeName(name) {
+			continue
+		}
+		values = uniqueStrings(values)
+		if len(values) == 0 {
+			continue
+		}
+		if cleaned == nil {
+			cleaned = make(map[string][]string)
+		}
+		cleaned[name] = values
+	}
+	return cleaned
+}
+
+// categorySchema trims category and returns it spelled as in its attribute schema, along
+// with the schema, which is nil when the category has none. Schemas are matched regardless
+// of case, so items saved with the canonical spelling are found by the category filter.
+func categorySchema(category string) (string, *models.AttributeSchema, error) {
+	category = strings.TrimSpace(category)
+	if category == "" {
+		return "", nil, nil
+	}
+	schema, err := database.GetCategoryAttributeSchema(category)
+	if err != nil || schema == nil {
+		return category, nil, err
+	}
+	return schema.Category, schema, nil
+}
+
+// checkItemAttributes validates the attributes of an item against the schema of its category
+// and normalizes the category, see categorySchema. Null values are dropped, so sending null
+// removes an optional attribute.
+func checkItemAttributes(item *models.Item) (validation.Errors, error) {
+	for name, value := range item.Attributes {
+		if value == nil {
+			delete(item.Attributes, name)
+		}
+	}
+
+	category, schema, err := categorySchema(item.Category)
+	if err != nil {
+		return nil, err
+	}
+	item.Category = category
+
+	var errs validation.Errors
+	if schema == nil {
+		if len(item.Attributes) > 0 {
+			errs = append(errs, validation.FieldError{Field: "attributes", Message: "are not defined for this category"})
+		}
+		return errs, nil
+	}
+
+	definitions := make(map[string]models.AttributeDefinition, len(schema.Attributes))
+	for _, definition := range schema.Attributes {
+		definitions[definition.Name] = definition
+		if _, ok := item.Attributes[definition.Name]; definition.Required && !ok {
+			errs = append(errs, validation.FieldError{Field: "attributes." + definition.Name, Message: "is required"})
+		}
+	}
+	for name, value := range item.Attributes {
+		definition, ok := definitions[name]
+		if !ok {
+			errs = append(errs, validation.FieldError{Field: "attributes." + name, Message: "is not defined for this category"})
+			continue
+		}
+		if msg := checkAttributeValue(definition, value); msg != "" {
+			errs = append(errs, validation.FieldError{Field: "attributes." + name, Message: msg})
+		}
+	}
+
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+	return errs, nil
+}
+
+// checkAttributeValue returns why value does not fit the attribute definition, or ""
+func checkAttributeValue(definition models.AttributeDefinition, value interface{}) string {
+	switch definition.Type {
+	case models.AttributeNumber:
+		if _, ok := value.(float64); !ok {
+			return "must be a number"
+		}
+	case models.AttributeBoolean:
+		if _, ok := value.(bool); !ok {
+			return "must be true or false"
+		}
+	default:
+		text, ok := value.(string)
+		if !ok {
+			return "must be a string"
+		}
+		if strings.TrimSpace(text) == "" && definition.Required {
+			return "is required"
+		}
+		if len([]rune(text)) > maxAttributeTextLength {
+			return fmt.Sprintf("must be at most %d characters", maxAttributeTextLength)
+		}
+		if len(definition.Values) > 0 && !containsString(definition.Values, text) {
+			return "must be one of " + strings.Join(definition.Values, ", ")
+		}
+	}
+	return ""
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeAttributeSchema decodes and validates an attribute schema from the request body.
+// It writes the error response and returns false when the schema is invalid.
+func decodeAttributeSchema(w http.ResponseWriter, r *http.Request, schema *models.AttributeSchema) bool {
+	fieldErrs, err := decodeStrict(r, schema)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return false
+	}
+	if len(fieldErrs) == 0 {
+		fieldErrs = validation.Struct(schema)
+	}
+
+	schema.Category = strings.TrimSpace(schema.Category)
+	seen := make(map[string]bool, len(schema.Attributes))
+	for i, definition := range schema.Attributes {
+		field := fmt.Sprintf("attributes[%d]", i)
+		if definition.Name != "" && !models.ValidAttributeName(definition.Name) {
+			fieldErrs = append(fieldErrs, validation.FieldError{Field: field + ".name", Message: "must start with a letter and contain only letters, digits and underscores"})
+		}
+		if seen[definition.Name] {
+			fieldErrs = append(fieldErrs, validation.FieldError{Field: field + ".name", Message: "is already defined"})
+		}
+		seen[definition.Name] = true
+
+		switch definition.Type {
+		case models.AttributeEnum:
+			if len(definition.Values) == 0 {
+				fieldErrs = append(fieldErrs, validation.FieldError{Field: field + ".values", Message: "is required for enum attributes"})
+			}
+		case models.AttributeNumber, models.AttributeBoolean:
+			if len(definition.Values) > 0 {
+				fieldErrs = append(fieldErrs, validation.FieldError{Field: field + ".values", Message: "is only allowed for string and enum attributes"})
+			}
+		}
+	}
+
+	if len(fieldErrs) > 0 {
+		writeValidationErrors(w, fieldErrs)
+		return false
+	}
+	return true
+}
+
+// GetAttributeSchemas handles GET request for the attribute schemas, all of them or the one of ?category=
+func GetAttributeSchemas(w http.ResponseWriter, r *http.Request) {
+	schemas, err := database.GetAttributeSchemas()
+	if category := strings.TrimSpace(r.URL.Query().Get("category")); category != "" && err == nil {
+		var schema *models.AttributeSchema
+		schema, err = database.GetCategoryAttributeSchema(category)
+		schemas = []models.AttributeSchema{}
+		if schema != nil {
+			schemas = append(schemas, *schema)
+		}
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schemas)
+}
+
+// AddAttributeSchema handles POST request to define the attributes of a category
+func AddAttributeSchema(w http.ResponseWriter, r *http.Request) {
+	var schema models.AttributeSchema
+	if !decodeAttributeSchema(w, r, &schema) {
+		return
+	}
+
+	schema.ID = primitive.NewObjectID().Hex()
+	err := database.AddAttributeSchema(schema)
+	if mongo.IsDuplicateKeyError(err) {
+		http.Error(w, "The category already has an attribute schema", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(schema)
+}
+
+// UpdateAttributeSchema handles PUT request to replace an attribute schema
+func UpdateAttributeSchema(w http.ResponseWriter, r *http.Request) {
+	var schema models.AttributeSchema
+	if !decodeAttributeSchema(w, r, &schema) {
+		return
+	}
+	if schema.ID == "" {
+		writeValidationErrors(w, validation.Errors{{Field: "_id", Message: "is required"}})
+		return
+	}
+
+	if _, err := database.GetAttributeSchema(schema.ID); err == mongo.ErrNoDocuments {
+		http.Error(w, "Attribute schema not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	err := database.UpdateAttributeSchema(schema)
+	if mongo.IsDuplicateKeyError(err) {
+		http.Error(w, "The category already has an attribute schema", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// DeleteAttributeSchema handles DELETE request to delete an attribute schema by its id
+func DeleteAttributeSchema(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(mux.Vars(r)["id"])
+	if id == "" {
+		http.Error(w, "Missing id parameter", http.StatusBadRequest)
+		return
+	}
+
+	if err := database.DeleteAttributeSchema(id); err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
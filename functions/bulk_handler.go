@@ -0,0 +1,316 @@
+package functions
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"minna-style-hub/database"
+	"minna-style-hub/markdown"
+	models "minna-style-hub/model"
+	"minna-style-hub/recommend"
+	"minna-style-hub/validation"
+	"net/http"
+	"strings"
+)
+
+// maxBulkItems caps how many items a single bulk request may touch
+const maxBulkItems = 1000
+
+// bulkSettableFields lists the item fields that the "set" operation may change
+var bulkSettableFields = map[string]bool{
+	"title":      true,
+	"text":       true,
+	"brand":      true,
+	"buttonLink": true,
+	"category":   true,
+}
+
+// prepareBulkSet applies a set operation that changes title, text or category to every
+// item in memory, as UpdateItem would. The new text is the same for every item, so the
+// HTML rendered from it is added to op.Fields once. Items the new category would make
+// invalid, e.g. because its schema requires attributes they lack, are returned as failed
+// results and left out of the ids. Nothing is written, so a dry run reports the same
+// failures. The items are returned by id so their slugs can follow a new title afterwards.
+func prepareBulkSet(op *database.BulkOperation, ids []string) ([]string, []database.BulkItemResult, map[string]models.Item, error) {
+	_, title := op.Fields["title"]
+	_, text := op.Fields["text"]
+	_, category := op.Fields["category"]
+	if op.Type != database.BulkSet || (!title && !text && !category) {
+		return ids, nil, nil, nil
+	}
+
+	if text {
+		html, err := markdown.ToHTML(op.Fields["text"].(string))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		op.Fields["textHtml"] = html
+	}
+
+	items, err := database.GetItemsByIDs(ids)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	byID := make(map[string]models.Item, len(items))
+	for _, item := range items {
+		byID[item.ID] = item
+	}
+
+	if category {
+		// Every item gets the category as checkItemAttributes would normalize it
+		normalized, _, err := categorySchema(op.Fields["category"].(string))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		op.Fields["category"] = normalized
+	}
+
+	var kept []string
+	var failed []database.BulkItemResult
+	for _, id := range ids {
+		item, ok := byID[id]
+		if !ok {
+			// Reported as not found by BulkApplyToItems
+			kept = append(kept, id)
+			continue
+		}
+
+		if category {
+			item.Category = op.Fields["category"].(string)
+			errs, err := checkItemAttributes(&item)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			if len(errs) > 0 {
+				failed = append(failed, database.BulkItemResult{ID: id, Status: database.BulkResultFailed, Error: errs.Error()})
+				continue
+			}
+		}
+		kept = append(kept, id)
+	}
+	return kept, failed, byID, nil
+}
+
+// updateBulkSlugs lets the slugs of the updated items follow a new title, like UpdateItem
+// does. Slugs an admin pinned are kept. The items are updated already, so an item whose
+// slug cannot follow keeps its old one and the error is noted on its result.
+func updateBulkSlugs(op database.BulkOperation, results []database.BulkItemResult, items map[string]models.Item) {
+	title, ok := op.Fields["title"].(string)
+	if !ok {
+		return
+	}
+	for i, result := range results {
+		item, found := items[result.ID]
+		if result.Status != database.BulkResultOK || !found || item.SlugManual {
+			continue
+		}
+		newSlug, err := database.UniqueSlug(title, item.ID)
+		if err == nil && newSlug != item.Slug {
+			err = database.SetItemSlug(item, newSlug, false)
+		}
+		if err != nil {
+			log.Println(err)
+			results[i].Error = "updated, but the slug could not follow the new title"
+		}
+	}
+}
+
+// bulkFilter mirrors the /items query filters in a JSON body
+type bulkFilter struct {
+	Brand      string              `json:"brand"`
+	Query      string              `json:"q"`
+	Tag        string              `json:"tag"`
+	Status     string              `json:"status"`
+	Category   string              `json:"category"`
+	Attributes map[string][]string `json:"attributes"`
+}
+
+// bulkRequest is the body accepted by the bulk endpoint
+type bulkRequest struct {
+	IDs       []string               `json:"ids"`
+	Filter    *bulkFilter            `json:"filter"`
+	Operation database.BulkOperation `json:"operation"`
+	DryRun    bool                   `json:"dryRun"`
+}
+
+// validateBulkOperation checks that the operation is known and carries the arguments it needs
+func validateBulkOperation(op *database.BulkOperation) error {
+	switch op.Type {
+	case database.BulkSet:
+		if len(op.Fields) == 0 {
+			return fmt.Errorf("set operation requires fields")
+		}
+		for field, value := range op.Fields {
+			if !bulkSettableFields[field] {
+				return fmt.Errorf("field %q cannot be set in bulk", field)
+			}
+			if _, ok := value.(string); !ok {
+				return fmt.Errorf("field %q must be a string", field)
+			}
+		}
+	case database.BulkAddTag, database.BulkRemoveTag:
+		op.Tag = strings.TrimSpace(op.Tag)
+		if op.Tag == "" {
+			return fmt.Errorf("%s operation requires a tag", op.Type)
+		}
+	case database.BulkSetStatus:
+		if !models.ValidStatus(op.Status) {
+			return fmt.Errorf("invalid status %q", op.Status)
+		}
+	case database.BulkDelete:
+	default:
+		return fmt.Errorf("unknown operation %q", op.Type)
+	}
+	return nil
+}
+
+// validateBulkFields applies the item validation rules to the values of a set operation
+func validateBulkFields(op database.BulkOperation) validation.Errors {
+	if op.Type != database.BulkSet {
+		return nil
+	}
+
+	encoded, err := json.Marshal(op.Fields)
+	if err != nil {
+		return validation.Errors{{Field: "operation.fields", Message: err.Error()}}
+	}
+	var item models.Item
+	if err := json.Unmarshal(encoded, &item); err != nil {
+		return validation.Errors{{Field: "operation.fields", Message: err.Error()}}
+	}
+
+	fields := make([]string, 0, len(op.Fields))
+	for field := range op.Fields {
+		fields = append(fields, field)
+	}
+	return validation.Partial(item, fields)
+}
+
+// BulkItems handles POST request to apply one operation to many items at once
+func BulkItems(w http.ResponseWriter, r *http.Request) {
+	var req bulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Println(err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	if (len(req.IDs) == 0) == (req.Filter == nil) {
+		http.Error(w, "Provide either ids or filter", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateBulkOperation(&req.Operation); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if fieldErrs := validateBulkFields(req.Operation); len(fieldErrs) > 0 {
+		writeValidationErrors(w, fieldErrs)
+		return
+	}
+
+	ids := req.IDs
+	if req.Filter != nil {
+		filter := database.ItemFilter{
+			Brand:      strings.TrimSpace(req.Filter.Brand),
+			Query:      strings.TrimSpace(req.Filter.Query),
+			Tag:        strings.TrimSpace(req.Filter.Tag),
+			Status:     strings.TrimSpace(req.Filter.Status),
+			Category:   strings.TrimSpace(req.Filter.Category),
+			Attributes: cleanAttributeFilter(req.Filter.Attributes),
+		}
+		// An empty filter would match the whole catalog, which is never what a bulk edit means
+		if filter.IsEmpty() {
+			http.Error(w, "Filter must not be empty", http.StatusBadRequest)
+			return
+		}
+
+		var err error
+		ids, err = database.FindItemIDs(filter)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	ids = uniqueStrings(ids)
+	if len(ids) > maxBulkItems {
+		http.Error(w, fmt.Sprintf("Bulk requests are limited to %d items", maxBulkItems), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	kept, failed, items, err := prepareBulkSet(&req.Operation, ids)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	var applied []database.BulkItemResult
+	if req.DryRun {
+		// The items that would be written, as BulkApplyToItems would report them
+		existing, err := database.ExistingItemIDs(kept)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		for _, id := range kept {
+			status := database.BulkResultOK
+			if !existing[id] {
+				status = database.BulkResultNotFound
+			}
+			applied = append(applied, database.BulkItemResult{ID: id, Status: status})
+		}
+	} else {
+		applied, err = database.BulkApplyToItems(kept, req.Operation)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		recommend.Invalidate()
+
+		updateBulkSlugs(req.Operation, applied, items)
+	}
+
+	// Report the results in the order of the ids
+	byID := make(map[string]database.BulkItemResult, len(ids))
+	for _, result := range append(applied, failed...) {
+		byID[result.ID] = result
+	}
+	results := make([]database.BulkItemResult, len(ids))
+	for i, id := range ids {
+		results[i] = byID[id]
+	}
+
+	affected := 0
+	for _, result := range results {
+		if result.Status == database.BulkResultOK {
+			affected++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"dryRun":   req.DryRun,
+		"affected": affected,
+		"results":  results,
+	})
+}
+
+// uniqueStrings drops empty and duplicate values while keeping the original order
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		unique = append(unique, value)
+	}
+	return unique
+}
@@ -0,0 +1,188 @@
+package functions
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"minna-style-hub/database"
+	models "minna-style-hub/model"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// botUserAgents are user agent fragments of crawlers and link previewers whose clicks are not counted
+var botUserAgents = []string{
+	"bot", "crawl", "spider", "slurp", "facebookexternalhit", "embedly",
+	"preview", "headless", "curl", "wget", "python-requests", "go-http-client",
+	"httpclient", "okhttp", "lighthouse",
+}
+
+// isBot reports whether the user agent looks automated. Empty user agents count as bots.
+func isBot(userAgent string) bool {
+	ua := strings.ToLower(strings.TrimSpace(userAgent))
+	if ua == "" {
+		return true
+	}
+	for _, fragment := range botUserAgents {
+		if strings.Contains(ua, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// clickHashSalt is the secret IP addresses are hashed with, see ConfigureClickHashSalt
+var clickHashSalt string
+
+// trustedProxyHops is the number of proxies in front of the server that append to
+// X-Forwarded-For, see ConfigureClickHashSalt
+var trustedProxyHops = 1
+
+// ConfigureClickHashSalt sets up how visitors of outbound clicks are told apart. The salt
+// is CLICK_HASH_SALT or, when that is unset, a random salt generated once and kept in the
+// database, as an unsalted hash of an IPv4 address is easily reversed. TRUSTED_PROXY_HOPS
+// (default 1) is the number of proxies whose X-Forwarded-For entries are trusted.
+func ConfigureClickHashSalt() error {
+	if value := os.Getenv("TRUSTED_PROXY_HOPS"); value != "" {
+		hops, err := strconv.Atoi(value)
+		if err != nil || hops < 0 {
+			return fmt.Errorf("invalid TRUSTED_PROXY_HOPS %q", value)
+		}
+		trustedProxyHops = hops
+	}
+
+	if salt := os.Getenv("CLICK_HASH_SALT"); salt != "" {
+		clickHashSalt = salt
+		return nil
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	salt, err := database.ClickHashSalt(hex.EncodeToString(raw))
+	if err != nil {
+		return err
+	}
+	clickHashSalt = salt
+	return nil
+}
+
+// clientIP returns the address of the visitor. Proxies append the address they received a
+// request from to X-Forwarded-For, so only the entry added by the outermost trusted proxy
+// is used; anything before it was sent by the client and may be forged.
+func clientIP(r *http.Request) string {
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	if trustedProxyHops > 0 && len(forwarded) >= trustedProxyHops {
+		if ip := strings.TrimSpace(forwarded[len(forwarded)-trustedProxyHops]); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// hashIP hashes an IP address with the salt so raw addresses are never stored
+func hashIP(ip string) string {
+	sum := sha256.Sum256([]byte(clickHashSalt + ip))
+	return hex.EncodeToString(sum[:])
+}
+
+// TrackClick handles GET request to /go/{itemId}: it records the click and redirects to the item's ButtonLink
+func TrackClick(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["itemId"]
+
+	item, err := findPublishedItem(id)
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Item not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if item.ButtonLink == "" {
+		http.Error(w, "Item has no link", http.StatusNotFound)
+		return
+	}
+
+	userAgent := r.UserAgent()
+	if !isBot(userAgent) {
+		click := models.Click{
+			ID:        primitive.NewObjectID().Hex(),
+			ItemID:    item.ID,
+			Brand:     item.Brand,
+			Timestamp: time.Now().UTC(),
+			Referrer:  r.Referer(),
+			IPHash:    hashIP(clientIP(r)),
+			UserAgent: userAgent,
+		}
+		// Don't make the visitor wait for the write
+		go func() {
+			if err := database.AddClick(click); err != nil {
+				log.Println("Error recording click:", err)
+			}
+		}()
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, item.ButtonLink, http.StatusFound)
+}
+
+// GetClickStats handles GET request for click counts grouped by item, brand or day
+func GetClickStats(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	groupBy := query.Get("groupBy")
+	if groupBy == "" {
+		groupBy = database.ClicksByItem
+	}
+	if groupBy != database.ClicksByItem && groupBy != database.ClicksByBrand && groupBy != database.ClicksByDay {
+		http.Error(w, "Invalid groupBy, expected item, brand or day", http.StatusBadRequest)
+		return
+	}
+
+	var from, to time.Time
+	var err error
+	if value := query.Get("from"); value != "" {
+		if from, err = time.Parse("2006-01-02", value); err != nil {
+			http.Error(w, "Invalid from date, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		if to, err = time.Parse("2006-01-02", value); err != nil {
+			http.Error(w, "Invalid to date, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		// Include the whole "to" day
+		to = to.AddDate(0, 0, 1)
+	}
+
+	counts, err := database.CountClicks(groupBy, from, to)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"groupBy": groupBy,
+		"result":  counts,
+	})
+}
@@ -0,0 +1,118 @@
+package functions
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"minna-style-hub/database"
+	models "minna-style-hub/model"
+	"minna-style-hub/recommend"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// copyItem returns a copy of item that shares no slices or maps with it, so the
+// clone's images, tags and translations can be changed independently
+func copyItem(item models.Item) models.Item {
+	clone := item
+	clone.Images = copyImages(item.Images)
+	clone.Tags = append([]string(nil), item.Tags...)
+	if item.Translations != nil {
+		clone.Translations = make(map[string]models.ItemTranslation, len(item.Translations))
+		for loc, translation := range item.Translations {
+			clone.Translations[loc] = translation
+		}
+	}
+	return clone
+}
+
+// copyImages returns a copy of images that shares no alt texts or focal points with it
+func copyImages(images []models.Image) []models.Image {
+	if images == nil {
+		return nil
+	}
+	copied := make([]models.Image, len(images))
+	for i, img := range images {
+		copied[i] = img
+		if img.Alt != nil {
+			copied[i].Alt = make(map[string]string, len(img.Alt))
+			for loc, alt := range img.Alt {
+				copied[i].Alt[loc] = alt
+			}
+		}
+		if img.FocalPoint != nil {
+			focal := *img.FocalPoint
+			copied[i].FocalPoint = &focal
+		}
+	}
+	return copied
+}
+
+// CloneItem handles POST request to copy an item into a new draft, e.g. for a new colourway.
+// The optional body holds item fields that replace the copied values. The clone gets a new
+// id and slug and records the id of the source item in ClonedFrom.
+func CloneItem(w http.ResponseWriter, r *http.Request) {
+	source, err := findItem(mux.Vars(r)["id"])
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Item not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	clone := copyItem(source)
+	// The slug is derived from the new title unless the overrides pick one
+	clone.Slug = ""
+	clone.SlugManual = false
+
+	// Overrides are decoded over the copy, so only the fields in the body change
+	fieldErrs, err := decodeStrict(r, &clone)
+	if err != nil && err != io.EOF {
+		log.Println(err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if len(fieldErrs) == 0 {
+		fieldErrs, err = validateItem(r, &clone)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if len(fieldErrs) > 0 {
+		writeValidationErrors(w, fieldErrs)
+		return
+	}
+
+	if !prepareNewItem(w, &clone) {
+		return
+	}
+	clone.Status = models.StatusDraft
+	clone.ClonedFrom = source.ID
+
+	if err := database.AddItem(clone); err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	recommend.Invalidate()
+
+	created, err := database.GetItem(clone.ID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	addItemImageSets(&created)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
@@ -0,0 +1,237 @@
+package functions
+
+import (
+	"encoding/json"
+	"log"
+	"minna-style-hub/database"
+	"minna-style-hub/locale"
+	models "minna-style-hub/model"
+	"minna-style-hub/slug"
+	"minna-style-hub/validation"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// embedItems fills Items of each collection with its referenced items in order.
+// Items that were deleted or are not published are left out.
+func embedItems(collections []models.Collection, loc string) error {
+	var ids []string
+	for _, c := range collections {
+		ids = append(ids, c.ItemIDs...)
+	}
+
+	items, err := database.GetItemsByIDs(uniqueStrings(ids))
+	if err != nil {
+		return err
+	}
+	locale.LocalizeAll(items, loc)
+	addImageSets(items)
+
+	byID := make(map[string]models.Item, len(items))
+	for _, item := range items {
+		if item.IsPublished() {
+			byID[item.ID] = item
+		}
+	}
+
+	for i := range collections {
+		collections[i].Items = []models.Item{}
+		for _, id := range collections[i].ItemIDs {
+			if item, ok := byID[id]; ok {
+				collections[i].Items = append(collections[i].Items, item)
+			}
+		}
+	}
+	return nil
+}
+
+// GetCollections handles GET request to list the published collections with their items
+func GetCollections(w http.ResponseWriter, r *http.Request) {
+	collections, err := database.GetCollections(models.StatusPublished)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	loc := locale.FromRequest(r)
+	if err := embedItems(collections, loc); err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	locale.SetHeaders(w, loc)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collections)
+}
+
+// GetCollection handles GET request to fetch one published collection by slug with its items
+func GetCollection(w http.ResponseWriter, r *http.Request) {
+	collection, err := database.GetCollection(mux.Vars(r)["slug"])
+	if err == mongo.ErrNoDocuments || (err == nil && collection.Status != models.StatusPublished) {
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	loc := locale.FromRequest(r)
+	collections := []models.Collection{collection}
+	if err := embedItems(collections, loc); err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	locale.SetHeaders(w, loc)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collections[0])
+}
+
+// GetAllCollections handles GET request to list every collection regardless of status for admins
+func GetAllCollections(w http.ResponseWriter, r *http.Request) {
+	collections, err := database.GetCollections("")
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collections)
+}
+
+// decodeCollection reads and validates a collection from the request body.
+// It writes the error response itself and returns false when the body is unusable.
+func decodeCollection(w http.ResponseWriter, r *http.Request, c *models.Collection) bool {
+	fieldErrs, err := decodeStrict(r, c)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return false
+	}
+	if len(fieldErrs) == 0 {
+		fieldErrs = validation.Struct(c)
+	}
+	if c.Slug != "" && !slug.Valid(c.Slug) {
+		fieldErrs = append(fieldErrs, validation.FieldError{Field: "slug", Message: "may only contain lowercase letters, digits and single hyphens"})
+	}
+	if len(fieldErrs) > 0 {
+		writeValidationErrors(w, fieldErrs)
+		return false
+	}
+
+	c.ItemIDs = uniqueStrings(c.ItemIDs)
+	c.Items = nil
+	if c.Status == "" {
+		c.Status = models.StatusDraft
+	}
+	return true
+}
+
+// assignCollectionSlug keeps a requested slug when it is free or derives one from the title
+func assignCollectionSlug(w http.ResponseWriter, c *models.Collection) bool {
+	if c.Slug == "" {
+		var err error
+		c.Slug, err = database.UniqueCollectionSlug(c.Title, c.ID)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return false
+		}
+		return true
+	}
+
+	available, err := database.CollectionSlugAvailable(c.Slug, c.ID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+	if !available {
+		http.Error(w, "Slug is already used by another collection", http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// AddCollection handles POST request to add a collection
+func AddCollection(w http.ResponseWriter, r *http.Request) {
+	var c models.Collection
+	if !decodeCollection(w, r, &c) {
+		return
+	}
+
+	c.ID = primitive.NewObjectID().Hex()
+	if !assignCollectionSlug(w, &c) {
+		return
+	}
+
+	if err := database.AddCollection(c); err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(c)
+}
+
+// UpdateCollection handles PUT request to update a collection
+func UpdateCollection(w http.ResponseWriter, r *http.Request) {
+	var c models.Collection
+	if !decodeCollection(w, r, &c) {
+		return
+	}
+	if c.ID == "" {
+		writeValidationErrors(w, validation.Errors{{Field: "_id", Message: "is required"}})
+		return
+	}
+
+	if _, err := database.GetCollection(c.ID); err == mongo.ErrNoDocuments {
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if !assignCollectionSlug(w, &c) {
+		return
+	}
+
+	if err := database.UpdateCollection(c); err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// DeleteCollection handles DELETE request to delete a collection by its id
+func DeleteCollection(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(mux.Vars(r)["id"])
+	if id == "" {
+		http.Error(w, "Missing id parameter", http.StatusBadRequest)
+		return
+	}
+
+	if err := database.DeleteCollection(id); err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,252 @@
+package functions
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"minna-style-hub/database"
+	models "minna-style-hub/model"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// exportTimeout bounds how long a single export may keep the cursor open
+const exportTimeout = 5 * time.Minute
+
+// exportFlushEvery controls how often buffered output is pushed to the client
+const exportFlushEvery = 100
+
+// itemFieldNames lists the JSON field names of models.Item in declaration order
+var itemFieldNames = jsonFieldNames(reflect.TypeOf(models.Item{}))
+
+func jsonFieldNames(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// parseExportFields validates the comma separated fields parameter against the item fields
+func parseExportFields(raw string) ([]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return itemFieldNames, nil
+	}
+
+	known := make(map[string]bool, len(itemFieldNames))
+	for _, name := range itemFieldNames {
+		known[name] = true
+	}
+
+	var fields []string
+	seen := make(map[string]bool)
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" || seen[field] {
+			continue
+		}
+		if !known[field] {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+		seen[field] = true
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// exportRecord converts an item into its JSON representation restricted to the given fields
+func exportRecord(item models.Item, fields []string) ([]json.RawMessage, error) {
+	encoded, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &all); err != nil {
+		return nil, err
+	}
+
+	values := make([]json.RawMessage, len(fields))
+	for i, field := range fields {
+		value, ok := all[field]
+		if !ok {
+			value = json.RawMessage("null")
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// writeJSONObject writes the selected fields as a JSON object keeping the requested order
+func writeJSONObject(buf *bytes.Buffer, fields []string, values []json.RawMessage) {
+	buf.WriteByte('{')
+	for i, field := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(field)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(values[i])
+	}
+	buf.WriteByte('}')
+}
+
+// csvCell flattens a JSON value into a CSV cell, joining lists with "|". Lists of
+// objects with a URL, such as images, are flattened to their URLs.
+func csvCell(value json.RawMessage) string {
+	var decoded interface{}
+	if err := json.Unmarshal(value, &decoded); err != nil {
+		return string(value)
+	}
+
+	switch v := decoded.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, part := range v {
+			if s, ok := part.(string); ok {
+				parts[i] = s
+				continue
+			}
+			if object, ok := part.(map[string]interface{}); ok {
+				if url, ok := object["url"].(string); ok {
+					parts[i] = url
+					continue
+				}
+			}
+			encoded, _ := json.Marshal(part)
+			parts[i] = string(encoded)
+		}
+		return strings.Join(parts, "|")
+	case map[string]interface{}:
+		return string(value)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// ExportItems handles GET request to stream the item catalog as CSV, JSON or NDJSON
+func ExportItems(w http.ResponseWriter, r *http.Request) {
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = "json"
+	}
+
+	var contentType string
+	switch format {
+	case "csv":
+		contentType = "text/csv; charset=utf-8"
+	case "json":
+		contentType = "application/json"
+	case "ndjson":
+		contentType = "application/x-ndjson"
+	default:
+		http.Error(w, "Invalid format, expected csv, json or ndjson", http.StatusBadRequest)
+		return
+	}
+
+	fields, err := parseExportFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		http.Error(w, "Invalid fields: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter := parseItemFilter(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), exportTimeout)
+	defer cancel()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"items.%s\"", format))
+
+	flusher, _ := w.(http.Flusher)
+	var csvWriter *csv.Writer
+	var buf bytes.Buffer
+	written := 0
+
+	switch format {
+	case "csv":
+		csvWriter = csv.NewWriter(w)
+		if err := csvWriter.Write(fields); err != nil {
+			log.Println(err)
+			return
+		}
+	case "json":
+		buf.WriteByte('[')
+	}
+
+	err = database.StreamItems(ctx, filter, fields, func(item models.Item) error {
+		values, err := exportRecord(item, fields)
+		if err != nil {
+			return err
+		}
+
+		switch format {
+		case "csv":
+			row := make([]string, len(values))
+			for i, value := range values {
+				row[i] = csvCell(value)
+			}
+			if err := csvWriter.Write(row); err != nil {
+				return err
+			}
+		case "json":
+			if written > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONObject(&buf, fields, values)
+		case "ndjson":
+			writeJSONObject(&buf, fields, values)
+			buf.WriteByte('\n')
+		}
+		written++
+
+		if buf.Len() > 0 {
+			if _, err := w.Write(buf.Bytes()); err != nil {
+				return err
+			}
+			buf.Reset()
+		}
+		if written%exportFlushEvery == 0 {
+			if csvWriter != nil {
+				csvWriter.Flush()
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// Headers are already sent at this point, so the best we can do is log and stop
+		log.Println(err)
+		return
+	}
+
+	switch format {
+	case "csv":
+		csvWriter.Flush()
+	case "json":
+		buf.WriteByte(']')
+		w.Write(buf.Bytes())
+	}
+}
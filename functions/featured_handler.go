@@ -0,0 +1,94 @@
+package functions
+
+import (
+	"encoding/json"
+	"log"
+	"minna-style-hub/database"
+	"minna-style-hub/locale"
+	models "minna-style-hub/model"
+	"net/http"
+	"os"
+)
+
+// maxFeaturedItems bounds the length of the featured ordering
+const maxFeaturedItems = 100
+
+// defaultItemSort returns the ITEMS_DEFAULT_SORT sort order used by /items when the
+// request has none, or natural order when it is unset or unknown
+func defaultItemSort() string {
+	sort := os.Getenv("ITEMS_DEFAULT_SORT")
+	if !database.ValidItemSort(sort) {
+		log.Printf("Invalid ITEMS_DEFAULT_SORT %q, using natural order", sort)
+		return ""
+	}
+	return sort
+}
+
+// GetFeaturedItems handles GET request to /items/featured for the published featured items in order
+func GetFeaturedItems(w http.ResponseWriter, r *http.Request) {
+	filter := parseItemFilter(r)
+	filter.PublishedOnly = true
+	items, err := database.GetFeaturedItems(filter)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if items == nil {
+		items = []models.Item{}
+	}
+
+	loc := locale.FromRequest(r)
+	locale.LocalizeAll(items, loc)
+	addImageSets(items)
+	locale.SetHeaders(w, loc)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+// SetFeaturedItems handles PUT request to /items/featured replacing the featured ordering.
+// The body lists every featured item id in order; items left out are no longer featured.
+func SetFeaturedItems(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.Println(err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	ids := uniqueStrings(body.IDs)
+	if len(ids) != len(body.IDs) {
+		http.Error(w, "Featured item ids must be unique and not empty", http.StatusBadRequest)
+		return
+	}
+	if len(ids) > maxFeaturedItems {
+		http.Error(w, "Too many featured items", http.StatusBadRequest)
+		return
+	}
+
+	if len(ids) > 0 {
+		existing, err := database.ExistingItemIDs(ids)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		for _, id := range ids {
+			if !existing[id] {
+				http.Error(w, "Featured item not found: "+id, http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	if err := database.SetFeaturedItems(ids); err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
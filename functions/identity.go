@@ -0,0 +1,21 @@
+package functions
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// deviceIDPattern restricts anonymous device ids sent in the X-Device-ID header
+var deviceIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{8,128}$`)
+
+// requestOwner identifies who owns the data of a request: the anonymous device in the
+// X-Device-ID header, or "" if the header is missing or malformed. The API has no customer
+// accounts, logins are for admins only, so data such as wishlists stays on the device.
+func requestOwner(r *http.Request) string {
+	deviceID := strings.TrimSpace(r.Header.Get("X-Device-ID"))
+	if !deviceIDPattern.MatchString(deviceID) {
+		return ""
+	}
+	return "device:" + deviceID
+}
@@ -0,0 +1,255 @@
+package functions
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"minna-style-hub/database"
+	"minna-style-hub/imaging"
+	models "minna-style-hub/model"
+	"minna-style-hub/storage"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// assetPathPattern matches the path of URLs served by ServeAsset and captures the asset id
+var assetPathPattern = regexp.MustCompile(`/assets/([0-9a-f]{24})$`)
+
+// variantsMu serialises generating missing variants, so concurrent requests for an older
+// upload don't all resize the same image
+var variantsMu sync.Mutex
+
+// assetIDFromURL returns the id of the uploaded asset an image URL points to
+func assetIDFromURL(raw string) (string, bool) {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	match := assetPathPattern.FindStringSubmatch(parsed.Path)
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+// imageSet builds the responsive renditions of an image. Images hosted elsewhere only get their URL.
+// Sources lists the WebP variants first, for <picture> to pick when the browser supports
+// them, then the JPEG or PNG ones that Srcset holds as well.
+func imageSet(imageURL string, assets map[string]models.Asset) models.ImageSet {
+	set := models.ImageSet{URL: imageURL}
+	id, ok := assetIDFromURL(imageURL)
+	if !ok {
+		return set
+	}
+	asset, ok := assets[id]
+	if !ok {
+		return set
+	}
+
+	set.Width = asset.Width
+	set.Height = asset.Height
+	var webpSources, sources []models.ImageSource
+	var srcset []string
+	for _, variant := range asset.Variants {
+		source := models.ImageSource{
+			URL:    fmt.Sprintf("%s/%d", imageURL, variant.Width),
+			Width:  variant.Width,
+			Height: variant.Height,
+			Type:   variant.ContentType,
+		}
+		if variant.ContentType == imaging.WebPType {
+			source.URL += ".webp"
+			webpSources = append(webpSources, source)
+			continue
+		}
+		sources = append(sources, source)
+		srcset = append(srcset, fmt.Sprintf("%s %dw", source.URL, source.Width))
+	}
+	if len(srcset) > 0 && asset.Width > 0 {
+		set.Sources = append(webpSources, sources...)
+		set.Sources = append(set.Sources, models.ImageSource{URL: imageURL, Width: asset.Width, Height: asset.Height, Type: asset.ContentType})
+		srcset = append(srcset, fmt.Sprintf("%s %dw", imageURL, asset.Width))
+		set.Srcset = strings.Join(srcset, ", ")
+	}
+	return set
+}
+
+// addImageSets fills ImageSets of the items for responses. Failing to look up the uploaded
+// images only costs the responsive renditions, so errors are logged and not returned.
+func addImageSets(items []models.Item) {
+	var ids []string
+	for _, item := range items {
+		for _, img := range item.Images {
+			if id, ok := assetIDFromURL(img.URL); ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	assets, err := database.GetAssetsByIDs(uniqueStrings(ids))
+	if err != nil {
+		log.Println("Error loading image variants:", err)
+		assets = nil
+	}
+
+	for i := range items {
+		items[i].ImageSets = nil
+		for j, img := range items[i].Images {
+			items[i].ImageSets = append(items[i].ImageSets, imageSet(img.URL, assets))
+			// Items saved before images had metadata get it from the asset
+			if id, ok := assetIDFromURL(img.URL); ok && img.Width == 0 {
+				if asset, found := assets[id]; found {
+					applyAssetMetadata(&items[i].Images[j], asset)
+				}
+			}
+		}
+	}
+}
+
+// applyAssetMetadata copies the fields derived from an uploaded image to img
+func applyAssetMetadata(img *models.Image, asset models.Asset) {
+	img.Width = asset.Width
+	img.Height = asset.Height
+	img.DominantColor = asset.DominantColor
+	img.Blurhash = asset.Blurhash
+}
+
+// ensurePlaceholder computes the dominant colour and blurhash of images uploaded before
+// they existed. Failing only costs the placeholder, so errors are logged.
+func ensurePlaceholder(ctx context.Context, asset *models.Asset) {
+	if asset.Blurhash != "" || asset.Width == 0 {
+		return
+	}
+
+	img, err := imaging.Load(ctx, storage.Current(), asset.Key)
+	if err != nil {
+		log.Println("Error loading image for placeholder:", err)
+		return
+	}
+	asset.DominantColor, asset.Blurhash = imaging.Placeholder(img)
+	if err := database.SetAssetPlaceholder(asset.ID, asset.DominantColor, asset.Blurhash); err != nil {
+		log.Println("Error saving image placeholder:", err)
+	}
+}
+
+// addItemImageSets fills ImageSets of a single item, see addImageSets
+func addItemImageSets(item *models.Item) {
+	items := []models.Item{*item}
+	addImageSets(items)
+	item.ImageSets = items[0].ImageSets
+}
+
+// hasVariants reports whether the variants of asset are complete. Uploads stored before
+// variants existed have none and those stored before WebP variants lack them.
+func hasVariants(asset models.Asset) bool {
+	for _, variant := range asset.Variants {
+		if variant.ContentType == imaging.WebPType {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureVariants generates the variants of older uploads that are missing some, see hasVariants
+func ensureVariants(r *http.Request, asset *models.Asset) error {
+	if hasVariants(*asset) || !imaging.Resizable(asset.ContentType) || asset.Width <= imaging.Widths[0] {
+		return nil
+	}
+
+	variantsMu.Lock()
+	defer variantsMu.Unlock()
+
+	// Another request may have generated them while this one waited
+	current, err := database.GetAsset(asset.ID)
+	if err != nil {
+		return err
+	}
+	if hasVariants(current) {
+		*asset = current
+		return nil
+	}
+
+	variants, err := imaging.Generate(r.Context(), storage.Current(), *asset)
+	if err != nil {
+		return err
+	}
+	if err := database.SetAssetVariants(asset.ID, variants); err != nil {
+		return err
+	}
+	asset.Variants = variants
+	return nil
+}
+
+// ServeAssetVariant handles GET request for a resized variant of an uploaded image, the
+// WebP one when the path ends in ".webp"
+func ServeAssetVariant(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	webp := vars["format"] == "webp"
+	width, err := strconv.Atoi(vars["width"])
+	if err != nil {
+		http.Error(w, "Invalid width", http.StatusBadRequest)
+		return
+	}
+
+	asset, err := database.GetAsset(vars["id"])
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Asset not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if err := ensureVariants(r, &asset); err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	var variant *models.AssetVariant
+	for i := range asset.Variants {
+		if asset.Variants[i].Width == width && (asset.Variants[i].ContentType == imaging.WebPType) == webp {
+			variant = &asset.Variants[i]
+		}
+	}
+	if variant == nil {
+		http.Error(w, "Variant not found", http.StatusNotFound)
+		return
+	}
+
+	etag := fmt.Sprintf(`"%s-%d"`, asset.ID, width)
+	if webp {
+		etag = fmt.Sprintf(`"%s-%d-webp"`, asset.ID, width)
+	}
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	body, err := storage.Current().Get(r.Context(), variant.Key)
+	if err == storage.ErrNotFound {
+		http.Error(w, "Variant not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", variant.ContentType)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	io.Copy(w, body)
+}
@@ -6,19 +6,38 @@ import (
 	"fmt"
 	"log"
 	"minna-style-hub/database"
+	"minna-style-hub/locale"
+	"minna-style-hub/markdown"
 	models "minna-style-hub/model"
+	"minna-style-hub/recommend"
 	"minna-style-hub/sendemail"
+	"minna-style-hub/validation"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
 
+	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // GetAllItems handles GET request to fetch all items// GetAllItems handles GET request to retrieve all items
-// GetAllItems handles GET request to fetch all items with pagination
+// GetAllItems handles GET request to fetch all published items with pagination
 func GetAllItems(w http.ResponseWriter, r *http.Request) {
+	listItems(w, r, true)
+}
+
+// GetAdminItems handles GET request to /admin/items, the item listing including drafts and
+// archived items for admins
+func GetAdminItems(w http.ResponseWriter, r *http.Request) {
+	listItems(w, r, false)
+}
+
+// listItems writes a page of the items matching the query string, leaving out the items
+// visitors may not see when publishedOnly is set
+func listItems(w http.ResponseWriter, r *http.Request, publishedOnly bool) {
 	// Parse pagination parameters
 	page := 1
 	pageSize := 10 // Default page size
@@ -45,8 +64,22 @@ func GetAllItems(w http.ResponseWriter, r *http.Request) {
 	// Calculate offset
 	offset := (page - 1) * pageSize
 
+	filter := parseItemFilter(r)
+	filter.PublishedOnly = publishedOnly
+
+	// Featured items are only placed first when the client did not ask for an order
+	sort := r.URL.Query().Get("sort")
+	pinFeatured := sort == ""
+	if sort == "" {
+		sort = defaultItemSort()
+	}
+	if !database.ValidItemSort(sort) {
+		http.Error(w, "Invalid sort", http.StatusBadRequest)
+		return
+	}
+
 	// Retrieve items from the database with pagination
-	items, err := database.GetItemsWithPagination(offset, pageSize)
+	items, err := database.GetItemsWithPagination(filter, sort, pinFeatured, offset, pageSize)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -54,53 +87,141 @@ func GetAllItems(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Retrieve total count of items
-	totalCount, err := database.GetTotalItemCount()
+	totalCount, err := database.GetTotalItemCount(filter)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
+	// Show title and text in the locale the client asked for
+	loc := locale.FromRequest(r)
+	locale.LocalizeAll(items, loc)
+	addImageSets(items)
+
 	// Construct paginated response
 	response := struct {
 		Meta struct {
-			Count  int `json:"count"`
-			Limit  int `json:"limit"`
-			Offset int `json:"offset"`
+			Count  int    `json:"count"`
+			Limit  int    `json:"limit"`
+			Offset int    `json:"offset"`
+			Locale string `json:"locale"`
 		} `json:"meta"`
 		Result []models.Item `json:"result"`
 	}{
 		Meta: struct {
-			Count  int `json:"count"`
-			Limit  int `json:"limit"`
-			Offset int `json:"offset"`
+			Count  int    `json:"count"`
+			Limit  int    `json:"limit"`
+			Offset int    `json:"offset"`
+			Locale string `json:"locale"`
 		}{
 			Count:  totalCount,
 			Limit:  pageSize,
 			Offset: offset,
+			Locale: loc,
 		},
 		Result: items,
 	}
 
 	// Set response headers and encode response
+	locale.SetHeaders(w, loc)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// parseItemFilter reads the item filters shared by /items and /items/export from the query string.
+// Attributes are filtered with attr.<name>=<value>, repeated to accept several values.
+func parseItemFilter(r *http.Request) database.ItemFilter {
+	query := r.URL.Query()
+	return database.ItemFilter{
+		Brand:      strings.TrimSpace(query.Get("brand")),
+		Query:      strings.TrimSpace(query.Get("q")),
+		Tag:        strings.TrimSpace(query.Get("tag")),
+		Status:     strings.TrimSpace(query.Get("status")),
+		Category:   strings.TrimSpace(query.Get("category")),
+		Attributes: parseAttributeFilter(query),
+	}
+}
+
+// GetItem handles GET request to fetch a single published item by its id or slug.
+// Slugs the item used before a rename are answered with a permanent redirect.
 func GetItem(w http.ResponseWriter, r *http.Request) {
-	// Extract item ID from URL path
+	// Extract item ID or slug from URL path
 	id := strings.TrimPrefix(r.URL.Path, "/item/")
 	if id == "" {
 		http.Error(w, "Missing id parameter", http.StatusBadRequest)
 		return
 	}
 
-	item, err := database.GetItem(id)
+	item, err := findPublishedItem(id)
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Item not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if item.ID != id && item.Slug != id {
+		// Matched an old slug, send the client to the current one
+		target := "/item/" + url.PathEscape(item.Slug)
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+		return
+	}
+
+	loc := locale.FromRequest(r)
+	locale.Localize(&item, loc)
+	addItemImageSets(&item)
+
+	locale.SetHeaders(w, loc)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(item)
+}
+
+// findItem resolves an item from either its hex ObjectID or one of its slugs
+func findItem(idOrSlug string) (models.Item, error) {
+	if primitive.IsValidObjectID(idOrSlug) {
+		item, err := database.GetItem(idOrSlug)
+		if err != mongo.ErrNoDocuments {
+			return item, err
+		}
+	}
+
+	item, _, err := database.GetItemBySlug(idOrSlug)
+	return item, err
+}
+
+// findPublishedItem resolves an item like findItem, treating items visitors may not see
+// as not found
+func findPublishedItem(idOrSlug string) (models.Item, error) {
+	item, err := findItem(idOrSlug)
+	if err == nil && !item.IsPublished() {
+		return models.Item{}, mongo.ErrNoDocuments
+	}
+	return item, err
+}
+
+// GetAdminItem handles GET request to /admin/items/{id} for an item in any status, with its
+// content in the default locale as it is edited
+func GetAdminItem(w http.ResponseWriter, r *http.Request) {
+	item, err := findItem(mux.Vars(r)["id"])
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Item not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
+
+	addItemImageSets(&item)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(item)
 }
@@ -108,42 +229,174 @@ func GetItem(w http.ResponseWriter, r *http.Request) {
 // AddItem handles POST request to add an item
 func AddItem(w http.ResponseWriter, r *http.Request) {
 	var newItem models.Item
-	if err := json.NewDecoder(r.Body).Decode(&newItem); err != nil {
+	fieldErrs, err := decodeStrict(r, &newItem)
+	if err != nil {
 		log.Println(err)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
+	if len(fieldErrs) == 0 {
+		fieldErrs, err = validateItem(r, &newItem)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if len(fieldErrs) > 0 {
+		writeValidationErrors(w, fieldErrs)
+		return
+	}
 
-	// Generate a new ObjectId for the item
-	newItemID := primitive.NewObjectID()
-	newItem.ID = newItemID.Hex() // Convert ObjectID to string
+	if !prepareNewItem(w, &newItem) {
+		return
+	}
 
-	err := database.AddItem(newItem)
+	err = database.AddItem(newItem)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
+	recommend.Invalidate()
 
 	w.WriteHeader(http.StatusCreated)
 }
 
+// validateItem rejects items read in another locale than the default one, resolves
+// references to uploaded images and checks the item against its validation tags and the
+// attribute schema of its category
+func validateItem(r *http.Request, item *models.Item) (validation.Errors, error) {
+	// A response localized for visitors carries translations in its base fields, saving
+	// it would replace the default content with them
+	if item.Locale != "" && item.Locale != locale.Default {
+		return validation.Errors{{Field: "locale", Message: "must be " + locale.Default + ", edit the item as returned by /admin/items/{id}"}}, nil
+	}
+	errs, err := resolveImages(r, item)
+	if err != nil || len(errs) > 0 {
+		return errs, err
+	}
+	if errs := validation.Struct(*item); len(errs) > 0 {
+		return errs, nil
+	}
+	return checkItemAttributes(item)
+}
+
+// prepareNewItem renders the text of an item about to be added, gives it a fresh id and slug
+// and clears the fields managed by the server. It writes the error response and returns false
+// when the item cannot be added.
+func prepareNewItem(w http.ResponseWriter, newItem *models.Item) bool {
+	// Render the Markdown text once on write, reads serve the cached HTML
+	if err := markdown.RenderItem(newItem); err != nil {
+		log.Println(err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return false
+	}
+
+	// Generate a new ObjectId for the item
+	newItemID := primitive.NewObjectID()
+	newItem.ID = newItemID.Hex() // Convert ObjectID to string
+
+	// Link check results, related pins, ratings and the clone source have their own writers
+	newItem.LinkChecks = nil
+	newItem.RelatedPins = nil
+	newItem.Rating = 0
+	newItem.ReviewCount = 0
+	newItem.ClonedFrom = ""
+
+	// A slug sent with a new item is taken as a manual choice, otherwise derive it from the title
+	newItem.SlugHistory = nil
+	if newItem.Slug != "" {
+		status, msg := checkManualSlug(newItem.Slug, newItem.ID)
+		if status != http.StatusOK {
+			http.Error(w, msg, status)
+			return false
+		}
+		newItem.SlugManual = true
+	} else {
+		newSlug, err := database.UniqueSlug(newItem.Title, "")
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return false
+		}
+		newItem.Slug = newSlug
+		newItem.SlugManual = false
+	}
+	return true
+}
+
 // UpdateItem handles PUT request to update an item
 func UpdateItem(w http.ResponseWriter, r *http.Request) {
 	var updatedItem models.Item
-	if err := json.NewDecoder(r.Body).Decode(&updatedItem); err != nil {
+	fieldErrs, err := decodeStrict(r, &updatedItem)
+	if err != nil {
 		log.Println(err)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
+	if len(fieldErrs) == 0 {
+		fieldErrs, err = validateItem(r, &updatedItem)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if updatedItem.ID == "" {
+			fieldErrs = append(fieldErrs, validation.FieldError{Field: "_id", Message: "is required"})
+		}
+	}
+	if len(fieldErrs) > 0 {
+		writeValidationErrors(w, fieldErrs)
+		return
+	}
 
-	err := database.UpdateItem(updatedItem)
+	if err := markdown.RenderItem(&updatedItem); err != nil {
+		log.Println(err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	existing, err := database.GetItem(updatedItem.ID)
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Item not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
+	err = database.UpdateItem(updatedItem)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	recommend.Invalidate()
+
+	if updatedItem.Price != existing.Price && publicBaseURL != "" {
+		go notifyPriceChange(updatedItem, publicBaseURL)
+	}
+	if existing.OutOfStock && !updatedItem.OutOfStock {
+		queueStockNotifications(updatedItem.ID)
+	}
+
+	// Slugs are managed by the server: follow title changes unless an admin pinned the slug
+	// through PUT /items/{id}/slug. Slug fields in the update body are ignored.
+	if !existing.SlugManual && (existing.Title != updatedItem.Title || existing.Slug == "") {
+		newSlug, err := database.UniqueSlug(updatedItem.Title, existing.ID)
+		if err == nil && newSlug != existing.Slug {
+			err = database.SetItemSlug(existing, newSlug, false)
+		}
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -163,6 +416,7 @@ func DeleteItem(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
+	recommend.Invalidate()
 
 	w.WriteHeader(http.StatusOK)
 }
@@ -183,14 +437,22 @@ func GetFeedback(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var feedbackItem models.Feedback
-	if err := json.NewDecoder(r.Body).Decode(&feedbackItem); err != nil {
+	fieldErrs, err := decodeStrict(r, &feedbackItem)
+	if err != nil {
 		log.Println(err)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
+	if len(fieldErrs) == 0 {
+		fieldErrs = validation.Struct(feedbackItem)
+	}
+	if len(fieldErrs) > 0 {
+		writeValidationErrors(w, fieldErrs)
+		return
+	}
 
 	// Parse form data
-	err := r.ParseForm()
+	err = r.ParseForm()
 	if err != nil {
 		http.Error(w, "Failed to parse form", http.StatusBadRequest)
 		return
@@ -252,15 +514,25 @@ func SearchItemsHandler(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    // Perform search in the database
-    items, err := database.SearchItems(query)
+    sort := r.URL.Query().Get("sort")
+    if !database.ValidItemSort(sort) && sort != database.SortRelevance {
+        http.Error(w, "Invalid sort", http.StatusBadRequest)
+        return
+    }
+
+    // Perform search in the database, within the requested locale
+    loc := locale.FromRequest(r)
+    items, err := database.SearchItems(query, loc, sort)
     if err != nil {
         log.Println(err)
         http.Error(w, "Internal Server Error", http.StatusInternalServerError)
         return
     }
+    locale.LocalizeAll(items, loc)
+    addImageSets(items)
 
     // Set response headers and encode response
+    locale.SetHeaders(w, loc)
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(items)
 }
@@ -0,0 +1,70 @@
+package functions
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"minna-style-hub/database"
+	"minna-style-hub/linkcheck"
+	models "minna-style-hub/model"
+	"net/http"
+)
+
+// brokenLinkReport lists the broken links of one item
+type brokenLinkReport struct {
+	ItemID string             `json:"itemId"`
+	Title  string             `json:"title"`
+	Brand  string             `json:"brand"`
+	Slug   string             `json:"slug,omitempty"`
+	Links  []models.LinkCheck `json:"links"`
+}
+
+// GetBrokenLinks handles GET request for the report of items with broken links
+func GetBrokenLinks(w http.ResponseWriter, r *http.Request) {
+	items, err := database.GetItemsWithBrokenLinks()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	report := make([]brokenLinkReport, 0, len(items))
+	for _, item := range items {
+		entry := brokenLinkReport{
+			ItemID: item.ID,
+			Title:  item.Title,
+			Brand:  item.Brand,
+			Slug:   item.Slug,
+			Links:  []models.LinkCheck{},
+		}
+		for _, link := range item.LinkChecks {
+			if !link.OK {
+				entry.Links = append(entry.Links, link)
+			}
+		}
+		report = append(report, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":  len(report),
+		"result": report,
+	})
+}
+
+// CheckLinks handles POST request to start a link check right away
+func CheckLinks(w http.ResponseWriter, r *http.Request) {
+	checker, _ := linkcheck.FromEnv()
+
+	// The check outlives the request, so it must not use the request context
+	go func() {
+		checked, broken, err := linkcheck.RunOnce(context.Background(), checker)
+		if err != nil {
+			log.Println("Error checking links:", err)
+			return
+		}
+		log.Printf("Checked %d links, %d broken", checked, broken)
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,43 @@
+package functions
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"minna-style-hub/imagegc"
+	"minna-style-hub/storage"
+	"net/http"
+)
+
+// GetOrphanedImages handles GET request for a dry run of the image garbage collection:
+// the uploads nothing refers to and when they will be deleted
+func GetOrphanedImages(w http.ResponseWriter, r *http.Request) {
+	_, grace := imagegc.FromEnv()
+
+	report, err := imagegc.Scan(r.Context(), storage.Current(), grace)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// SweepOrphanedImages handles POST request to delete orphaned images past their grace period right away
+func SweepOrphanedImages(w http.ResponseWriter, r *http.Request) {
+	_, grace := imagegc.FromEnv()
+
+	// The sweep outlives the request, so it must not use the request context
+	go func() {
+		deleted, err := imagegc.RunOnce(context.Background(), storage.Current(), grace)
+		if err != nil {
+			log.Println("Error collecting orphaned images:", err)
+			return
+		}
+		log.Printf("Deleted %d orphaned images", deleted)
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,173 @@
+package functions
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"minna-style-hub/database"
+	models "minna-style-hub/model"
+	"minna-style-hub/storage"
+	"minna-style-hub/validation"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// presignExpiry is how long a presigned upload URL, and the pending upload, stay valid
+const presignExpiry = 15 * time.Minute
+
+// PresignUpload handles POST request for a URL the browser uploads an image to directly.
+// The client PUTs the file to uploadUrl with the returned headers and then calls
+// completePath, which checks the image and turns it into an asset.
+func PresignUpload(w http.ResponseWriter, r *http.Request) {
+	if !requirePublicBaseURL(w) {
+		return
+	}
+
+	presigner, ok := storage.Current().(storage.Presigner)
+	if !ok {
+		http.Error(w, "Direct uploads need the s3 storage backend, use POST /uploads", http.StatusNotImplemented)
+		return
+	}
+
+	var body struct {
+		Filename    string `json:"filename" validate:"required,max=255"`
+		ContentType string `json:"contentType" validate:"required,oneof=image/jpeg|image/png|image/gif|image/webp"`
+		Size        int64  `json:"size" validate:"required,min=1"`
+	}
+	fieldErrs, err := decodeStrict(r, &body)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if len(fieldErrs) == 0 {
+		fieldErrs = validation.Struct(body)
+	}
+	if len(fieldErrs) > 0 {
+		writeValidationErrors(w, fieldErrs)
+		return
+	}
+	if body.Size > maxImageBytes {
+		http.Error(w, fmt.Sprintf("%s is larger than %d MB", body.Filename, maxImageBytes>>20), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	now := time.Now().UTC()
+	id := primitive.NewObjectID().Hex()
+	upload := models.PendingUpload{
+		ID:          id,
+		Key:         "uploads/" + id,
+		Filename:    filepath.Base(body.Filename),
+		ContentType: body.ContentType,
+		Size:        body.Size,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(presignExpiry),
+	}
+
+	uploadURL, err := presigner.PresignPut(r.Context(), upload.Key, upload.ContentType, upload.Size, presignExpiry)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if err := database.AddPendingUpload(upload); err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"_id":          upload.ID,
+		"uploadUrl":    uploadURL,
+		"method":       http.MethodPut,
+		"headers":      map[string]string{"Content-Type": upload.ContentType},
+		"expiresAt":    upload.ExpiresAt,
+		"completePath": "/uploads/" + upload.ID + "/complete",
+	})
+}
+
+// CompleteUpload handles POST request made once a presigned upload has finished. The
+// uploaded file is checked and re-encoded like any other upload before it becomes an
+// asset; the raw file is removed from storage either way.
+func CompleteUpload(w http.ResponseWriter, r *http.Request) {
+	if !requirePublicBaseURL(w) {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	// Completing twice returns the asset created the first time
+	if asset, err := database.GetAsset(id); err == nil {
+		asset.URL = assetURL(publicBaseURL, asset.ID)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(asset)
+		return
+	} else if err != mongo.ErrNoDocuments {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	upload, err := database.GetPendingUpload(id)
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Upload not found or expired", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	raw, err := storage.Current().Get(r.Context(), upload.Key)
+	if err == storage.ErrNotFound {
+		http.Error(w, "The file has not been uploaded yet", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(raw, maxImageBytes+1))
+	raw.Close()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	asset, status, msg := models.Asset{}, http.StatusRequestEntityTooLarge, fmt.Sprintf("%s is larger than %d MB", upload.Filename, maxImageBytes>>20)
+	if len(data) <= maxImageBytes {
+		asset, status, msg = storeImage(r.Context(), upload.ID, upload.Filename, data)
+	}
+	if status == http.StatusInternalServerError {
+		// Keep the raw file so completing can be retried
+		http.Error(w, msg, status)
+		return
+	}
+
+	if err := storage.Current().Delete(r.Context(), upload.Key); err != nil {
+		log.Println("Error deleting raw upload:", err)
+	}
+	if status != http.StatusCreated {
+		http.Error(w, msg, status)
+		return
+	}
+	if err := database.DeletePendingUpload(upload.ID); err != nil {
+		log.Println("Error deleting pending upload:", err)
+	}
+
+	asset.URL = assetURL(publicBaseURL, asset.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(asset)
+}
@@ -0,0 +1,272 @@
+package functions
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"minna-style-hub/database"
+	models "minna-style-hub/model"
+	"minna-style-hub/sendemail"
+	"minna-style-hub/validation"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GetPriceHistory handles GET request for the price changes of an item, oldest first
+func GetPriceHistory(w http.ResponseWriter, r *http.Request) {
+	offset, limit, ok := parsePage(r, 100, 1000)
+	if !ok {
+		http.Error(w, "Invalid page or limit", http.StatusBadRequest)
+		return
+	}
+
+	item, err := findPublishedItem(mux.Vars(r)["id"])
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Item not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	changes, total, err := database.GetPriceHistory(item.ID, offset, limit)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"meta": map[string]int{
+			"count":  total,
+			"limit":  limit,
+			"offset": offset,
+		},
+		"result": changes,
+	})
+}
+
+// AddPriceAlert handles POST request to subscribe an email address to price drops of an
+// item. The alert is only armed once the link emailed to the address is followed. The
+// threshold of a confirmed alert is changed through UpdatePriceAlert.
+func AddPriceAlert(w http.ResponseWriter, r *http.Request) {
+	if !requirePublicBaseURL(w) {
+		return
+	}
+
+	item, err := findPublishedItem(mux.Vars(r)["id"])
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Item not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	var body struct {
+		Email     string  `json:"email" validate:"required,email,max=254"`
+		Threshold float64 `json:"threshold" validate:"required,min=0"`
+	}
+	fieldErrs, err := decodeStrict(r, &body)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if len(fieldErrs) == 0 {
+		fieldErrs = validation.Struct(body)
+	}
+	if len(fieldErrs) > 0 {
+		writeValidationErrors(w, fieldErrs)
+		return
+	}
+
+	raw := make([]byte, 18)
+	if _, err := rand.Read(raw); err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC()
+	confirmBy := now.Add(confirmWindow)
+	alert, err := database.SavePriceAlert(models.PriceAlert{
+		ID:        primitive.NewObjectID().Hex(),
+		ItemID:    item.ID,
+		Email:     strings.ToLower(strings.TrimSpace(body.Email)),
+		Threshold: body.Threshold,
+		Token:     base64.RawURLEncoding.EncodeToString(raw),
+		CreatedAt: now,
+		ConfirmBy: &confirmBy,
+	})
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if alert.ConfirmedAt == nil {
+		claimed, err := database.ClaimPriceAlertConfirmationEmail(alert.ID)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if claimed {
+			go sendPriceAlertConfirmation(alert, item.Title)
+		}
+	}
+
+	// The answer is the same whether the address is subscribed already or not, so it
+	// cannot be used to find out who follows an item
+	writeSubscriptionAccepted(w)
+}
+
+// sendPriceAlertConfirmation emails the link that arms a price alert
+func sendPriceAlertConfirmation(alert models.PriceAlert, title string) {
+	title = strings.Join(strings.Fields(title), " ")
+	confirmURL := publicBaseURL + "/price-alerts/" + alert.Token + "/confirm"
+	unsubscribeURL := publicBaseURL + "/price-alerts/" + alert.Token + "/unsubscribe"
+	body := fmt.Sprintf("<p>Please confirm that you want an email when <strong>%s</strong> drops below %.2f.</p>",
+		html.EscapeString(title), alert.Threshold)
+	body += fmt.Sprintf("<p><a href=\"%s\">Confirm</a></p>", confirmURL)
+	body += "<p>If you did not ask for this, ignore this email and you will not hear from us again.</p>"
+
+	subject := fmt.Sprintf("Confirm your price alert: %s", title)
+	if err := sendConfirmationEmail(alert.Email, subject, body, unsubscribeURL); err != nil {
+		log.Println("Error sending price alert confirmation:", err)
+		if err := database.ReleasePriceAlertConfirmationEmail(alert.ID); err != nil {
+			log.Println("Error releasing price alert confirmation:", err)
+		}
+	}
+}
+
+// ConfirmPriceAlert handles the confirmation link emailed to a new price alert subscriber
+func ConfirmPriceAlert(w http.ResponseWriter, r *http.Request) {
+	found, err := database.ConfirmPriceAlert(mux.Vars(r)["token"])
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Price alert not found or expired", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "Your price alert is confirmed, we will email you when the price drops")
+}
+
+// UpdatePriceAlert handles PUT request to /price-alerts/{token} changing the threshold of an
+// alert. The token is only known to the subscribed address.
+func UpdatePriceAlert(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Threshold float64 `json:"threshold" validate:"required,min=0"`
+	}
+	fieldErrs, err := decodeStrict(r, &body)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if len(fieldErrs) == 0 {
+		fieldErrs = validation.Struct(body)
+	}
+	if len(fieldErrs) > 0 {
+		writeValidationErrors(w, fieldErrs)
+		return
+	}
+
+	found, err := database.SetPriceAlertThreshold(mux.Vars(r)["token"], body.Threshold)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Price alert not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// UnsubscribePriceAlert handles the GET and one-click POST unsubscribe links of price alert emails
+func UnsubscribePriceAlert(w http.ResponseWriter, r *http.Request) {
+	found, err := database.DeletePriceAlert(mux.Vars(r)["token"])
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Price alert not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "You have been unsubscribed from price alerts for this item")
+}
+
+// notifyPriceChange re-arms price alerts the new price reached again and emails the
+// subscribers whose threshold the price fell below. It is run after an item update.
+func notifyPriceChange(item models.Item, baseURL string) {
+	if err := database.RearmPriceAlerts(item.ID, item.Price); err != nil {
+		log.Println("Error re-arming price alerts:", err)
+		return
+	}
+	if item.Price <= 0 || (item.Status != "" && item.Status != models.StatusPublished) {
+		return
+	}
+
+	emailFrom := os.Getenv("EMAIL_FROM")
+	emailPass := os.Getenv("EMAIL_PASSWORD")
+	if emailFrom == "" || emailPass == "" {
+		log.Println("EMAIL_FROM or EMAIL_PASSWORD not set, price alerts not sent")
+		return
+	}
+
+	title := strings.Join(strings.Fields(item.Title), " ")
+	subject := fmt.Sprintf("Price drop: %s", title)
+	for {
+		alert, found, err := database.ClaimPriceAlert(item.ID, item.Price)
+		if err != nil {
+			log.Println("Error claiming price alert:", err)
+			return
+		}
+		if !found {
+			return
+		}
+
+		unsubscribeURL := baseURL + "/price-alerts/" + alert.Token + "/unsubscribe"
+		body := fmt.Sprintf("<p><strong>%s</strong> is now %.2f, below your alert price of %.2f.</p>",
+			html.EscapeString(title), item.Price, alert.Threshold)
+		if item.ButtonLink != "" {
+			body += fmt.Sprintf("<p><a href=\"%s/go/%s\">View the item</a></p>", baseURL, item.ID)
+		}
+		body += fmt.Sprintf("<p><a href=\"%s\">Unsubscribe</a> from alerts for this item.</p>", unsubscribeURL)
+
+		if err := sendemail.NotificationEmail(alert.Email, subject, body, unsubscribeURL, emailFrom, emailPass); err != nil {
+			log.Println("Error sending price alert:", err)
+			if err := database.ReleasePriceAlert(alert.ID); err != nil {
+				log.Println("Error releasing price alert:", err)
+			}
+			return
+		}
+	}
+}
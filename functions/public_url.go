@@ -0,0 +1,40 @@
+package functions
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// publicBaseURL is the address visitors reach this API on, without a trailing slash. Links
+// in emails and the URLs of uploaded images are built from it and never from the Host or
+// X-Forwarded-* headers of a request, which any visitor can set. It is empty when
+// PUBLIC_BASE_URL is not set, which disables the features that need absolute links.
+var publicBaseURL string
+
+// ConfigurePublicBaseURL reads PUBLIC_BASE_URL, which must be an absolute http or https
+// URL, and returns it without a trailing slash
+func ConfigurePublicBaseURL() (string, error) {
+	base := strings.TrimSuffix(os.Getenv("PUBLIC_BASE_URL"), "/")
+	if base == "" {
+		return "", fmt.Errorf("PUBLIC_BASE_URL not set")
+	}
+	u, err := url.Parse(base)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("invalid PUBLIC_BASE_URL %q", base)
+	}
+	publicBaseURL = base
+	return base, nil
+}
+
+// requirePublicBaseURL answers 503 and returns false when PUBLIC_BASE_URL is not set, for
+// the handlers that hand out absolute links
+func requirePublicBaseURL(w http.ResponseWriter) bool {
+	if publicBaseURL == "" {
+		http.Error(w, "Not available until PUBLIC_BASE_URL is configured", http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
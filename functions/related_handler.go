@@ -0,0 +1,163 @@
+package functions
+
+import (
+	"encoding/json"
+	"log"
+	"minna-style-hub/database"
+	"minna-style-hub/locale"
+	models "minna-style-hub/model"
+	"minna-style-hub/recommend"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Default and maximum number of related items returned
+const (
+	defaultRelatedLimit = 6
+	maxRelatedLimit     = 24
+)
+
+// GetRelatedItems handles GET request for the items related to an item.
+// Items pinned by an admin come first, followed by the most similar items.
+func GetRelatedItems(w http.ResponseWriter, r *http.Request) {
+	limit := defaultRelatedLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l < 1 || l > maxRelatedLimit {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = l
+	}
+
+	item, err := findPublishedItem(mux.Vars(r)["id"])
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Item not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Pins are checked first, so pinned items that were deleted or are not published leave
+	// their places to similar items
+	exclude := map[string]bool{item.ID: true}
+	var pins []string
+	for _, pin := range item.RelatedPins {
+		if !exclude[pin] {
+			pins = append(pins, pin)
+			exclude[pin] = true
+		}
+	}
+	items, err := publishedItemsByIDs(pins, limit)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if len(items) < limit {
+		scored, err := recommend.Related(r.Context(), item.ID, exclude, limit-len(items))
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		ids := make([]string, 0, len(scored))
+		for _, candidate := range scored {
+			ids = append(ids, candidate.ID)
+		}
+		similar, err := publishedItemsByIDs(ids, len(ids))
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		items = append(items, similar...)
+	}
+
+	loc := locale.FromRequest(r)
+	locale.LocalizeAll(items, loc)
+	addImageSets(items)
+
+	locale.SetHeaders(w, loc)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"result": items,
+	})
+}
+
+// publishedItemsByIDs returns up to limit of the published items with the given ids, in
+// the order of ids
+func publishedItemsByIDs(ids []string, limit int) ([]models.Item, error) {
+	items := []models.Item{}
+	if len(ids) == 0 {
+		return items, nil
+	}
+	found, err := database.GetItemsByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, related := range found {
+		if len(items) < limit && related.IsPublished() {
+			items = append(items, related)
+		}
+	}
+	return items, nil
+}
+
+// SetRelatedPins handles PUT request to choose the items always shown first as related to an item
+func SetRelatedPins(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var body struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.Println(err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	pins := uniqueStrings(body.IDs)
+	for _, pin := range pins {
+		if pin == id {
+			http.Error(w, "An item cannot be related to itself", http.StatusBadRequest)
+			return
+		}
+	}
+	if len(pins) > maxRelatedLimit {
+		http.Error(w, "Too many pinned items", http.StatusBadRequest)
+		return
+	}
+
+	existing, err := database.ExistingItemIDs(append([]string{id}, pins...))
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !existing[id] {
+		http.Error(w, "Item not found", http.StatusNotFound)
+		return
+	}
+	for _, pin := range pins {
+		if !existing[pin] {
+			http.Error(w, "Pinned item not found: "+pin, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := database.SetRelatedPins(id, pins); err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,218 @@
+package functions
+
+import (
+	"encoding/json"
+	"log"
+	"minna-style-hub/database"
+	models "minna-style-hub/model"
+	"minna-style-hub/validation"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// parsePage reads the page and limit query parameters shared by paginated endpoints
+func parsePage(r *http.Request, defaultLimit, maxLimit int) (offset, limit int, ok bool) {
+	page := 1
+	limit = defaultLimit
+	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+		p, err := strconv.Atoi(pageStr)
+		if err != nil || p < 1 {
+			return 0, 0, false
+		}
+		page = p
+	}
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l < 1 || l > maxLimit {
+			return 0, 0, false
+		}
+		limit = l
+	}
+	return (page - 1) * limit, limit, true
+}
+
+// writeReviews encodes a page of reviews in the same shape as the /items response
+func writeReviews(w http.ResponseWriter, reviews []models.Review, total, offset, limit int) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"meta": map[string]int{
+			"count":  total,
+			"limit":  limit,
+			"offset": offset,
+		},
+		"result": reviews,
+	})
+}
+
+// AddReview handles POST request to submit a review of an item. Reviews wait for moderation.
+func AddReview(w http.ResponseWriter, r *http.Request) {
+	item, err := findPublishedItem(mux.Vars(r)["id"])
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Item not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	var body struct {
+		Rating int    `json:"rating" validate:"required,min=1,max=5"`
+		Title  string `json:"title" validate:"required,max=120"`
+		Body   string `json:"body" validate:"max=5000"`
+		Author string `json:"author" validate:"required,max=100"`
+	}
+	fieldErrs, err := decodeStrict(r, &body)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if len(fieldErrs) == 0 {
+		fieldErrs = validation.Struct(body)
+	}
+	if len(fieldErrs) > 0 {
+		writeValidationErrors(w, fieldErrs)
+		return
+	}
+
+	review := models.Review{
+		ID:        primitive.NewObjectID().Hex(),
+		ItemID:    item.ID,
+		Rating:    body.Rating,
+		Title:     strings.TrimSpace(body.Title),
+		Body:      strings.TrimSpace(body.Body),
+		Author:    strings.TrimSpace(body.Author),
+		Status:    models.ReviewPending,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := database.AddReview(review); err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(review)
+}
+
+// GetItemReviews handles GET request for the approved reviews of an item
+func GetItemReviews(w http.ResponseWriter, r *http.Request) {
+	offset, limit, ok := parsePage(r, 10, 100)
+	if !ok {
+		http.Error(w, "Invalid page or limit", http.StatusBadRequest)
+		return
+	}
+
+	item, err := findPublishedItem(mux.Vars(r)["id"])
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Item not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	reviews, total, err := database.GetReviews(item.ID, models.ReviewApproved, offset, limit)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	writeReviews(w, reviews, total, offset, limit)
+}
+
+// GetReviewQueue handles GET request for the moderation queue, pending reviews unless ?status= says otherwise
+func GetReviewQueue(w http.ResponseWriter, r *http.Request) {
+	offset, limit, ok := parsePage(r, 50, 200)
+	if !ok {
+		http.Error(w, "Invalid page or limit", http.StatusBadRequest)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = models.ReviewPending
+	}
+	if status != models.ReviewPending && status != models.ReviewApproved && status != models.ReviewRejected {
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	reviews, total, err := database.GetReviews(r.URL.Query().Get("itemId"), status, offset, limit)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	writeReviews(w, reviews, total, offset, limit)
+}
+
+// ModerateReview handles PUT request to approve or reject a review
+func ModerateReview(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.Println(err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if body.Status != models.ReviewApproved && body.Status != models.ReviewRejected {
+		http.Error(w, "Status must be approved or rejected", http.StatusBadRequest)
+		return
+	}
+
+	review, err := database.GetReview(mux.Vars(r)["id"])
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Review not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := database.ModerateReview(review, body.Status); err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// DeleteReview handles DELETE request to remove a review
+func DeleteReview(w http.ResponseWriter, r *http.Request) {
+	review, err := database.GetReview(mux.Vars(r)["id"])
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Review not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := database.DeleteReview(review); err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,85 @@
+package functions
+
+import (
+	"encoding/json"
+	"log"
+	"minna-style-hub/database"
+	"minna-style-hub/slug"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// checkManualSlug verifies an admin chosen slug is well-formed and free for the item.
+// It returns http.StatusOK when the slug can be used, otherwise the status and message to send.
+func checkManualSlug(value, id string) (int, string) {
+	if !slug.Valid(value) {
+		return http.StatusBadRequest, "Slug may only contain lowercase letters, digits and single hyphens"
+	}
+
+	available, err := database.SlugAvailable(value, id)
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, "Internal Server Error"
+	}
+	if !available {
+		return http.StatusConflict, "Slug is already used by another item"
+	}
+	return http.StatusOK, ""
+}
+
+// SetItemSlug handles PUT request to override the slug of an item.
+// An empty slug hands slug management back to the server, which derives it from the title again.
+func SetItemSlug(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var body struct {
+		Slug string `json:"slug"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.Println(err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	item, err := database.GetItem(id)
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Item not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	newSlug := strings.TrimSpace(body.Slug)
+	manual := newSlug != ""
+	if manual {
+		if status, msg := checkManualSlug(newSlug, item.ID); status != http.StatusOK {
+			http.Error(w, msg, status)
+			return
+		}
+	} else {
+		newSlug, err = database.UniqueSlug(item.Title, item.ID)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := database.SetItemSlug(item, newSlug, manual); err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"slug":   newSlug,
+		"manual": manual,
+	})
+}
@@ -0,0 +1,189 @@
+package functions
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"minna-style-hub/database"
+	models "minna-style-hub/model"
+	"minna-style-hub/sendemail"
+	"minna-style-hub/stockalert"
+	"minna-style-hub/validation"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// confirmWindow is how long a new subscription waits for the visitor to confirm it
+const confirmWindow = 48 * time.Hour
+
+// AddStockAlert handles POST request to subscribe an email address to the return of an out
+// of stock item. The subscription is only active once the link emailed to the address is
+// followed, so nobody can sign up someone else's inbox.
+func AddStockAlert(w http.ResponseWriter, r *http.Request) {
+	if !requirePublicBaseURL(w) {
+		return
+	}
+
+	item, err := findPublishedItem(mux.Vars(r)["id"])
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Item not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !item.OutOfStock {
+		http.Error(w, "Item is in stock", http.StatusConflict)
+		return
+	}
+
+	var body struct {
+		Email string `json:"email" validate:"required,email,max=254"`
+	}
+	fieldErrs, err := decodeStrict(r, &body)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if len(fieldErrs) == 0 {
+		fieldErrs = validation.Struct(body)
+	}
+	if len(fieldErrs) > 0 {
+		writeValidationErrors(w, fieldErrs)
+		return
+	}
+
+	raw := make([]byte, 18)
+	if _, err := rand.Read(raw); err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC()
+	sub, err := database.SaveStockSubscription(models.StockSubscription{
+		ID:        primitive.NewObjectID().Hex(),
+		ItemID:    item.ID,
+		Email:     strings.ToLower(strings.TrimSpace(body.Email)),
+		Token:     base64.RawURLEncoding.EncodeToString(raw),
+		CreatedAt: now,
+		ExpiresAt: now.Add(confirmWindow),
+	})
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if sub.ConfirmedAt == nil {
+		claimed, err := database.ClaimStockConfirmationEmail(sub.ID)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if claimed {
+			go sendStockConfirmation(sub, item.Title)
+		}
+	}
+
+	// The same answer as for a new address, so it cannot be used to find out who follows an item
+	writeSubscriptionAccepted(w)
+}
+
+// sendStockConfirmation emails the link that activates a stock alert
+func sendStockConfirmation(sub models.StockSubscription, title string) {
+	title = strings.Join(strings.Fields(title), " ")
+	confirmURL := publicBaseURL + "/stock-alerts/" + sub.Token + "/confirm"
+	unsubscribeURL := publicBaseURL + "/stock-alerts/" + sub.Token + "/unsubscribe"
+	body := fmt.Sprintf("<p>Please confirm that you want an email when <strong>%s</strong> is back in stock.</p>", html.EscapeString(title))
+	body += fmt.Sprintf("<p><a href=\"%s\">Confirm</a></p>", confirmURL)
+	body += "<p>If you did not ask for this, ignore this email and you will not hear from us again.</p>"
+
+	subject := fmt.Sprintf("Confirm your stock alert: %s", title)
+	if err := sendConfirmationEmail(sub.Email, subject, body, unsubscribeURL); err != nil {
+		log.Println("Error sending stock alert confirmation:", err)
+		if err := database.ReleaseStockConfirmationEmail(sub.ID); err != nil {
+			log.Println("Error releasing stock alert confirmation:", err)
+		}
+	}
+}
+
+// writeSubscriptionAccepted answers a subscription request the same way whatever state the
+// subscription is in
+func writeSubscriptionAccepted(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "If the address is not subscribed yet, a confirmation email is on its way",
+	})
+}
+
+// sendConfirmationEmail sends the email asking a visitor to confirm a subscription
+func sendConfirmationEmail(to, subject, body, unsubscribeURL string) error {
+	emailFrom := os.Getenv("EMAIL_FROM")
+	emailPass := os.Getenv("EMAIL_PASSWORD")
+	if emailFrom == "" || emailPass == "" {
+		return fmt.Errorf("EMAIL_FROM or EMAIL_PASSWORD not set")
+	}
+	return sendemail.NotificationEmail(to, subject, body, unsubscribeURL, emailFrom, emailPass)
+}
+
+// ConfirmStockAlert handles the confirmation link emailed to a new stock alert subscriber
+func ConfirmStockAlert(w http.ResponseWriter, r *http.Request) {
+	_, ttl := stockalert.FromEnv()
+	found, err := database.ConfirmStockSubscription(mux.Vars(r)["token"], ttl)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Stock alert not found or expired", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "Your stock alert is confirmed, we will email you when the item is back in stock")
+}
+
+// UnsubscribeStockAlert handles the GET and one-click POST unsubscribe links of back-in-stock emails
+func UnsubscribeStockAlert(w http.ResponseWriter, r *http.Request) {
+	found, err := database.DeleteStockSubscription(mux.Vars(r)["token"])
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Stock alert not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "You have been unsubscribed from stock alerts for this item")
+}
+
+// queueStockNotifications queues the back-in-stock emails of an item that became available again
+func queueStockNotifications(itemID string) {
+	queued, err := database.QueueStockNotifications(itemID)
+	if err != nil {
+		log.Println("Error queueing back-in-stock notifications:", err)
+		return
+	}
+	if queued > 0 {
+		stockalert.Notify()
+	}
+}
@@ -0,0 +1,249 @@
+package functions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"minna-style-hub/database"
+	"minna-style-hub/imaging"
+	models "minna-style-hub/model"
+	"minna-style-hub/storage"
+	"minna-style-hub/validation"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxUploadBytes bounds the size of an upload request, maxImageBytes that of each image in it
+const (
+	maxUploadBytes = 50 << 20
+	maxImageBytes  = 10 << 20
+)
+
+// assetRefPrefix marks an entry of Images that refers to an uploaded asset by id
+const assetRefPrefix = "asset:"
+
+// uploadExtensions maps the types uploads are stored as to the extension of their file
+var uploadExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// assetURL returns the URL an asset is served at
+func assetURL(baseURL, id string) string {
+	return baseURL + "/assets/" + id
+}
+
+// UploadImages handles POST multipart request with one or more "file" parts and stores them
+// as assets. The response lists the assets with the URL each is served at.
+func UploadImages(w http.ResponseWriter, r *http.Request) {
+	if !requirePublicBaseURL(w) {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes)
+	if err := r.ParseMultipartForm(8 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Upload is larger than %d MB", maxUploadBytes>>20), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid upload, expected multipart form data", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	files := r.MultipartForm.File["file"]
+	if len(files) == 0 {
+		http.Error(w, "Missing file", http.StatusBadRequest)
+		return
+	}
+
+	baseURL := publicBaseURL
+	assets := make([]models.Asset, 0, len(files))
+	for _, header := range files {
+		asset, status, msg := storeUpload(r, header)
+		if status != http.StatusCreated {
+			http.Error(w, msg, status)
+			return
+		}
+		asset.URL = assetURL(baseURL, asset.ID)
+		assets = append(assets, asset)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(assets)
+}
+
+// storeUpload checks and saves one uploaded image. It returns http.StatusCreated with the
+// new asset, otherwise the status and message to send.
+func storeUpload(r *http.Request, header *multipart.FileHeader) (models.Asset, int, string) {
+	tooLarge := fmt.Sprintf("%s is larger than %d MB", header.Filename, maxImageBytes>>20)
+	if header.Size > maxImageBytes {
+		return models.Asset{}, http.StatusRequestEntityTooLarge, tooLarge
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		log.Println(err)
+		return models.Asset{}, http.StatusInternalServerError, "Internal Server Error"
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxImageBytes+1))
+	if err != nil {
+		log.Println(err)
+		return models.Asset{}, http.StatusInternalServerError, "Internal Server Error"
+	}
+	if len(data) > maxImageBytes {
+		return models.Asset{}, http.StatusRequestEntityTooLarge, tooLarge
+	}
+
+	return storeImage(r.Context(), primitive.NewObjectID().Hex(), filepath.Base(header.Filename), data)
+}
+
+// storeImage checks, re-encodes and saves an uploaded image as the asset with the given id.
+// It returns http.StatusCreated with the new asset, otherwise the status and message to send.
+func storeImage(ctx context.Context, id, filename string, data []byte) (models.Asset, int, string) {
+	// The type is taken from the content, never from the file name or the declared type
+	sanitized, err := imaging.Sanitize(data)
+	switch err {
+	case nil:
+	case imaging.ErrUnsupportedType:
+		return models.Asset{}, http.StatusUnsupportedMediaType, fmt.Sprintf("%s is not a JPEG, PNG, GIF or WebP image", filename)
+	case imaging.ErrTooLarge:
+		return models.Asset{}, http.StatusUnprocessableEntity, fmt.Sprintf("%s is too large, images may be at most %d pixels per side and %d megapixels", filename, imaging.MaxDimension, imaging.MaxPixels/1_000_000)
+	case imaging.ErrCorrupt:
+		return models.Asset{}, http.StatusUnprocessableEntity, fmt.Sprintf("%s could not be read as an image", filename)
+	default:
+		log.Println(err)
+		return models.Asset{}, http.StatusInternalServerError, "Internal Server Error"
+	}
+
+	asset := models.Asset{
+		ID:          id,
+		Key:         "assets/" + id + "/original" + uploadExtensions[sanitized.ContentType],
+		Filename:    filename,
+		ContentType: sanitized.ContentType,
+		Size:        int64(len(sanitized.Data)),
+		Width:       sanitized.Width,
+		Height:      sanitized.Height,
+		CreatedAt:   time.Now().UTC(),
+	}
+	asset.DominantColor, asset.Blurhash = imaging.Placeholder(sanitized.Image)
+
+	if err := storage.Current().Put(ctx, asset.Key, bytes.NewReader(sanitized.Data), asset.ContentType); err != nil {
+		log.Println(err)
+		return models.Asset{}, http.StatusInternalServerError, "Internal Server Error"
+	}
+
+	// Variants of older uploads are generated on their first request, so a failure here is not fatal
+	variants, err := imaging.GenerateFrom(ctx, storage.Current(), asset, sanitized.Image)
+	if err != nil {
+		log.Println("Error generating image variants:", err)
+	}
+	asset.Variants = variants
+
+	if err := database.AddAsset(asset); err != nil {
+		log.Println(err)
+		return models.Asset{}, http.StatusInternalServerError, "Internal Server Error"
+	}
+	return asset, http.StatusCreated, ""
+}
+
+// ServeAsset handles GET request for an uploaded file. Assets never change once stored,
+// so they may be cached forever.
+func ServeAsset(w http.ResponseWriter, r *http.Request) {
+	asset, err := database.GetAsset(mux.Vars(r)["id"])
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Asset not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	etag := `"` + asset.ID + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	body, err := storage.Current().Get(r.Context(), asset.Key)
+	if err == storage.ErrNotFound {
+		http.Error(w, "Asset not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", asset.ContentType)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	io.Copy(w, body)
+}
+
+// resolveImages replaces the "asset:<id>" image URLs of the item with the URL the asset
+// is served at and fills in the fields derived from uploaded images. Those fields are
+// managed by the server, so whatever the client sent for them is dropped. Unknown assets
+// are reported as field errors.
+func resolveImages(r *http.Request, item *models.Item) (validation.Errors, error) {
+	var ids []string
+	for _, img := range item.Images {
+		if strings.HasPrefix(img.URL, assetRefPrefix) {
+			ids = append(ids, strings.TrimPrefix(img.URL, assetRefPrefix))
+		} else if id, ok := assetIDFromURL(img.URL); ok {
+			ids = append(ids, id)
+		}
+	}
+
+	assets, err := database.GetAssetsByIDs(uniqueStrings(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	var errs validation.Errors
+	baseURL := publicBaseURL
+	for i := range item.Images {
+		img := &item.Images[i]
+		img.Width, img.Height, img.DominantColor, img.Blurhash = 0, 0, "", ""
+
+		id, ok := assetIDFromURL(img.URL)
+		if strings.HasPrefix(img.URL, assetRefPrefix) {
+			id, ok = strings.TrimPrefix(img.URL, assetRefPrefix), true
+			if _, found := assets[id]; !found {
+				errs = append(errs, validation.FieldError{Field: fmt.Sprintf("images[%d].url", i), Message: "refers to an unknown asset"})
+				continue
+			}
+			if baseURL == "" {
+				errs = append(errs, validation.FieldError{Field: fmt.Sprintf("images[%d].url", i), Message: "cannot refer to an asset until PUBLIC_BASE_URL is configured"})
+				continue
+			}
+			img.URL = assetURL(baseURL, id)
+		}
+		if asset, found := assets[id]; ok && found {
+			ensurePlaceholder(r.Context(), &asset)
+			applyAssetMetadata(img, asset)
+		}
+	}
+	return errs, nil
+}
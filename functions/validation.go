@@ -0,0 +1,47 @@
+package functions
+
+import (
+	"encoding/json"
+	"minna-style-hub/validation"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// decodeStrict decodes the JSON request body into v and rejects unknown fields.
+// Unknown fields come back as field errors so they can be reported with the
+// other validation failures; malformed JSON is returned as err.
+func decodeStrict(r *http.Request, v interface{}) (validation.Errors, error) {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(v)
+	if err == nil {
+		return nil, nil
+	}
+
+	// encoding/json has no typed error for unknown fields, only this message
+	const unknownPrefix = "json: unknown field "
+	if msg := err.Error(); strings.HasPrefix(msg, unknownPrefix) {
+		field, unquoteErr := strconv.Unquote(strings.TrimPrefix(msg, unknownPrefix))
+		if unquoteErr != nil {
+			field = strings.TrimPrefix(msg, unknownPrefix)
+		}
+		return validation.Errors{{Field: field, Message: "is not a known field"}}, nil
+	}
+
+	if typeErr, ok := err.(*json.UnmarshalTypeError); ok && typeErr.Field != "" {
+		return validation.Errors{{Field: typeErr.Field, Message: "must be of type " + typeErr.Type.String()}}, nil
+	}
+
+	return nil, err
+}
+
+// writeValidationErrors responds with 422 and the list of field errors
+func writeValidationErrors(w http.ResponseWriter, errs validation.Errors) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": errs,
+	})
+}
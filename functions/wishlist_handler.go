@@ -0,0 +1,332 @@
+package functions
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"minna-style-hub/database"
+	"minna-style-hub/locale"
+	models "minna-style-hub/model"
+	"minna-style-hub/validation"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Limits on wishlists per owner and items per wishlist
+const (
+	maxWishlistsPerOwner = 20
+	maxItemsPerWishlist  = 500
+)
+
+// ownerOrError resolves the wishlist owner and answers 401 when the request has no identity
+func ownerOrError(w http.ResponseWriter, r *http.Request) (string, bool) {
+	owner := requestOwner(r)
+	if owner == "" {
+		http.Error(w, "Missing X-Device-ID header", http.StatusUnauthorized)
+		return "", false
+	}
+	return owner, true
+}
+
+// embedWishlistItems fills Items of each wishlist with its saved items in order. Items that
+// were deleted or are not published are left out.
+func embedWishlistItems(wishlists []models.Wishlist, loc string) error {
+	var ids []string
+	for _, wishlist := range wishlists {
+		ids = append(ids, wishlist.ItemIDs...)
+	}
+
+	items, err := database.GetItemsByIDs(uniqueStrings(ids))
+	if err != nil {
+		return err
+	}
+	locale.LocalizeAll(items, loc)
+	addImageSets(items)
+
+	byID := make(map[string]models.Item, len(items))
+	for _, item := range items {
+		if item.IsPublished() {
+			byID[item.ID] = item
+		}
+	}
+
+	for i := range wishlists {
+		wishlists[i].Items = []models.Item{}
+		for _, id := range wishlists[i].ItemIDs {
+			if item, ok := byID[id]; ok {
+				wishlists[i].Items = append(wishlists[i].Items, item)
+			}
+		}
+	}
+	return nil
+}
+
+// writeWishlists localizes, embeds the items of and encodes the wishlists
+func writeWishlists(w http.ResponseWriter, r *http.Request, wishlists []models.Wishlist, single bool) {
+	loc := locale.FromRequest(r)
+	if err := embedWishlistItems(wishlists, loc); err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	locale.SetHeaders(w, loc)
+	w.Header().Set("Content-Type", "application/json")
+	if single {
+		json.NewEncoder(w).Encode(wishlists[0])
+		return
+	}
+	json.NewEncoder(w).Encode(wishlists)
+}
+
+// writeWishlistResult answers a wishlist mutation: 404 when the list does not exist for the owner
+func writeWishlistResult(w http.ResponseWriter, found bool, err error) {
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Wishlist not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetWishlists handles GET request to list the wishlists of the caller with their items
+func GetWishlists(w http.ResponseWriter, r *http.Request) {
+	owner, ok := ownerOrError(w, r)
+	if !ok {
+		return
+	}
+
+	wishlists, err := database.GetWishlists(owner)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	writeWishlists(w, r, wishlists, false)
+}
+
+// AddWishlist handles POST request to create a named wishlist
+func AddWishlist(w http.ResponseWriter, r *http.Request) {
+	owner, ok := ownerOrError(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Name string `json:"name" validate:"required,max=100"`
+	}
+	fieldErrs, err := decodeStrict(r, &body)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if len(fieldErrs) == 0 {
+		fieldErrs = validation.Struct(body)
+	}
+	if len(fieldErrs) > 0 {
+		writeValidationErrors(w, fieldErrs)
+		return
+	}
+
+	count, err := database.CountWishlists(owner)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if count >= maxWishlistsPerOwner {
+		http.Error(w, "Too many wishlists", http.StatusConflict)
+		return
+	}
+
+	now := time.Now().UTC()
+	wishlist := models.Wishlist{
+		ID:        primitive.NewObjectID().Hex(),
+		Owner:     owner,
+		Name:      strings.TrimSpace(body.Name),
+		ItemIDs:   []string{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := database.AddWishlist(wishlist); err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(wishlist)
+}
+
+// RenameWishlist handles PUT request to rename a wishlist
+func RenameWishlist(w http.ResponseWriter, r *http.Request) {
+	owner, ok := ownerOrError(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Name string `json:"name" validate:"required,max=100"`
+	}
+	fieldErrs, err := decodeStrict(r, &body)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if len(fieldErrs) == 0 {
+		fieldErrs = validation.Struct(body)
+	}
+	if len(fieldErrs) > 0 {
+		writeValidationErrors(w, fieldErrs)
+		return
+	}
+
+	found, err := database.RenameWishlist(mux.Vars(r)["id"], owner, strings.TrimSpace(body.Name))
+	writeWishlistResult(w, found, err)
+}
+
+// DeleteWishlist handles DELETE request to remove a wishlist
+func DeleteWishlist(w http.ResponseWriter, r *http.Request) {
+	owner, ok := ownerOrError(w, r)
+	if !ok {
+		return
+	}
+
+	found, err := database.DeleteWishlist(mux.Vars(r)["id"], owner)
+	writeWishlistResult(w, found, err)
+}
+
+// AddWishlistItem handles POST request to save an item to a wishlist
+func AddWishlistItem(w http.ResponseWriter, r *http.Request) {
+	owner, ok := ownerOrError(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		ItemID string `json:"itemId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.ItemID == "" {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	wishlist, err := database.GetWishlist(mux.Vars(r)["id"], owner)
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Wishlist not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Drafts and archived items cannot be saved, as visitors cannot see them
+	item, err := findPublishedItem(body.ItemID)
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Item not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	added, err := database.AddWishlistItem(wishlist.ID, owner, item.ID, maxItemsPerWishlist)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !added {
+		http.Error(w, "Wishlist is full", http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// RemoveWishlistItem handles DELETE request to remove an item from a wishlist
+func RemoveWishlistItem(w http.ResponseWriter, r *http.Request) {
+	owner, ok := ownerOrError(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	found, err := database.RemoveWishlistItem(vars["id"], owner, vars["itemId"])
+	writeWishlistResult(w, found, err)
+}
+
+// ShareWishlist handles POST request to create a public share link for a wishlist.
+// Sharing again replaces the token, which invalidates previously shared links.
+func ShareWishlist(w http.ResponseWriter, r *http.Request) {
+	owner, ok := ownerOrError(w, r)
+	if !ok {
+		return
+	}
+
+	raw := make([]byte, 18)
+	if _, err := rand.Read(raw); err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	found, err := database.SetWishlistShareToken(mux.Vars(r)["id"], owner, token)
+	if err != nil || !found {
+		writeWishlistResult(w, found, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"shareToken": token,
+		"path":       "/wishlists/shared/" + token,
+	})
+}
+
+// UnshareWishlist handles DELETE request to revoke the share link of a wishlist
+func UnshareWishlist(w http.ResponseWriter, r *http.Request) {
+	owner, ok := ownerOrError(w, r)
+	if !ok {
+		return
+	}
+
+	found, err := database.SetWishlistShareToken(mux.Vars(r)["id"], owner, "")
+	writeWishlistResult(w, found, err)
+}
+
+// GetSharedWishlist handles GET request for a wishlist opened through its share link
+func GetSharedWishlist(w http.ResponseWriter, r *http.Request) {
+	wishlist, err := database.GetSharedWishlist(mux.Vars(r)["token"])
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Wishlist not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// The share token grants read access only, don't hand it on
+	wishlist.ShareToken = ""
+	writeWishlists(w, r, []models.Wishlist{wishlist}, true)
+}
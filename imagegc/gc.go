@@ -0,0 +1,265 @@
+package imagegc
+
+import (
+	"context"
+	"log"
+	"minna-style-hub/database"
+	models "minna-style-hub/model"
+	"minna-style-hub/storage"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Key prefixes of uploaded assets and of raw presigned uploads in storage
+const (
+	assetsPrefix  = "assets/"
+	uploadsPrefix = "uploads/"
+)
+
+// OrphanAsset is an uploaded image that no item or collection refers to
+type OrphanAsset struct {
+	ID       string `json:"_id"`
+	Filename string `json:"filename"`
+	// Size is that of the original, the variants come on top
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"createdAt"`
+	DeleteAfter time.Time `json:"deleteAfter"`
+	keys        []string
+}
+
+// OrphanBlob is a stored object without an asset, such as the leftovers of an upload
+// that failed halfway or a presigned upload that was never completed
+type OrphanBlob struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+	DeleteAfter  time.Time `json:"deleteAfter"`
+}
+
+// Report lists everything a sweep would delete once its grace period has passed
+type Report struct {
+	GeneratedAt time.Time     `json:"generatedAt"`
+	GracePeriod string        `json:"gracePeriod"`
+	Assets      []OrphanAsset `json:"assets"`
+	Blobs       []OrphanBlob  `json:"blobs"`
+}
+
+// running guards against overlapping sweeps from the scheduler and manual triggers
+var running sync.Mutex
+
+// Scan finds the orphaned assets and blobs without deleting anything. Assets get a grace
+// period from the first scan that found them unreferenced, recorded on the asset, so an
+// image dropped by an edit is kept for grace whatever its age; referring to it again clears
+// the mark. Orphans are reported with the time from which a sweep may delete them.
+func Scan(ctx context.Context, store storage.Storage, grace time.Duration) (Report, error) {
+	report := Report{
+		GeneratedAt: time.Now().UTC(),
+		GracePeriod: grace.String(),
+		Assets:      []OrphanAsset{},
+		Blobs:       []OrphanBlob{},
+	}
+
+	// Candidates are collected before the references, so an asset uploaded and used
+	// while the scan runs is either not a candidate yet or already referenced
+	assets := make(map[string]models.Asset)
+	err := database.StreamAssets(ctx, func(asset models.Asset) error {
+		assets[asset.ID] = asset
+		return nil
+	})
+	if err != nil {
+		return Report{}, err
+	}
+
+	err = store.List(ctx, assetsPrefix, func(object storage.Object) error {
+		id, _, _ := strings.Cut(strings.TrimPrefix(object.Key, assetsPrefix), "/")
+		if _, ok := assets[id]; !ok {
+			report.Blobs = append(report.Blobs, orphanBlob(object, grace))
+		}
+		return nil
+	})
+	if err != nil {
+		return Report{}, err
+	}
+
+	err = store.List(ctx, uploadsPrefix, func(object storage.Object) error {
+		_, err := database.GetPendingUpload(strings.TrimPrefix(object.Key, uploadsPrefix))
+		if err == mongo.ErrNoDocuments {
+			report.Blobs = append(report.Blobs, orphanBlob(object, grace))
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return Report{}, err
+	}
+
+	referenced, err := database.ReferencedAssetIDs(ctx)
+	if err != nil {
+		return Report{}, err
+	}
+
+	var marked, unmarked []string
+	for id, asset := range assets {
+		switch {
+		case referenced[id] && asset.UnreferencedAt != nil:
+			unmarked = append(unmarked, id)
+		case !referenced[id] && asset.UnreferencedAt == nil:
+			marked = append(marked, id)
+		}
+	}
+	if len(unmarked) > 0 {
+		if err := database.ClearAssetsUnreferenced(ctx, unmarked); err != nil {
+			return Report{}, err
+		}
+	}
+	if len(marked) > 0 {
+		if err := database.MarkAssetsUnreferenced(ctx, marked, report.GeneratedAt); err != nil {
+			return Report{}, err
+		}
+	}
+
+	for id, asset := range assets {
+		if referenced[id] {
+			continue
+		}
+		since := report.GeneratedAt
+		if asset.UnreferencedAt != nil {
+			since = *asset.UnreferencedAt
+		}
+		orphan := OrphanAsset{
+			ID:          asset.ID,
+			Filename:    asset.Filename,
+			Size:        asset.Size,
+			CreatedAt:   asset.CreatedAt,
+			DeleteAfter: since.Add(grace),
+			keys:        []string{asset.Key},
+		}
+		for _, variant := range asset.Variants {
+			orphan.keys = append(orphan.keys, variant.Key)
+		}
+		report.Assets = append(report.Assets, orphan)
+	}
+	sort.Slice(report.Assets, func(i, j int) bool { return report.Assets[i].ID < report.Assets[j].ID })
+	return report, nil
+}
+
+func orphanBlob(object storage.Object, grace time.Duration) OrphanBlob {
+	return OrphanBlob{
+		Key:          object.Key,
+		Size:         object.Size,
+		LastModified: object.LastModified,
+		DeleteAfter:  object.LastModified.Add(grace),
+	}
+}
+
+// Sweep deletes the orphans of report whose grace period has passed and returns how
+// many assets and blobs it deleted. The report may be old, so each asset is checked to
+// still be unreferenced right before it is deleted. The metadata of an asset is deleted
+// before its files, so files left behind by a failure are found as orphaned blobs by the
+// next scan.
+func Sweep(ctx context.Context, store storage.Storage, report Report) (int, error) {
+	now := time.Now()
+	deleted := 0
+
+	for _, asset := range report.Assets {
+		if ctx.Err() != nil {
+			return deleted, ctx.Err()
+		}
+		if now.Before(asset.DeleteAfter) {
+			continue
+		}
+		referenced, err := database.AssetReferenced(ctx, asset.ID)
+		if err != nil {
+			return deleted, err
+		}
+		if referenced {
+			if err := database.ClearAssetsUnreferenced(ctx, []string{asset.ID}); err != nil {
+				return deleted, err
+			}
+			continue
+		}
+		if err := database.DeleteAsset(asset.ID); err != nil {
+			return deleted, err
+		}
+		for _, key := range asset.keys {
+			if err := store.Delete(ctx, key); err != nil {
+				return deleted, err
+			}
+		}
+		deleted++
+	}
+
+	for _, blob := range report.Blobs {
+		if ctx.Err() != nil {
+			return deleted, ctx.Err()
+		}
+		if now.Before(blob.DeleteAfter) {
+			continue
+		}
+		if err := store.Delete(ctx, blob.Key); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// RunOnce scans for orphans and deletes those past the grace period. It returns
+// without doing anything when another run is in progress.
+func RunOnce(ctx context.Context, store storage.Storage, grace time.Duration) (int, error) {
+	if !running.TryLock() {
+		return 0, nil
+	}
+	defer running.Unlock()
+
+	report, err := Scan(ctx, store, grace)
+	if err != nil {
+		return 0, err
+	}
+	return Sweep(ctx, store, report)
+}
+
+// Start sweeps orphaned images every interval until ctx is cancelled
+func Start(ctx context.Context, interval, grace time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := RunOnce(ctx, storage.Current(), grace)
+		if err != nil {
+			log.Println("Error collecting orphaned images:", err)
+		} else if deleted > 0 {
+			log.Printf("Deleted %d orphaned images", deleted)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// FromEnv returns IMAGE_GC_INTERVAL (default 24h, 0 disables the sweeper), the time
+// between sweeps, and IMAGE_GC_GRACE (default 168h), how long an unreferenced upload
+// is kept before it is deleted
+func FromEnv() (interval, grace time.Duration) {
+	return envDuration("IMAGE_GC_INTERVAL", 24*time.Hour), envDuration("IMAGE_GC_GRACE", 7*24*time.Hour)
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed < 0 {
+		log.Printf("Invalid %s %q, using %s", name, value, fallback)
+		return fallback
+	}
+	return parsed
+}
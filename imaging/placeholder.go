@@ -0,0 +1,164 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// placeholderSize is the longest side of the thumbnail placeholders are computed from
+const placeholderSize = 32
+
+// Blurhash components along the width and the height
+const (
+	blurhashX = 4
+	blurhashY = 3
+)
+
+// Placeholder returns the dominant colour of img as "#rrggbb" and its blurhash, which
+// clients show while the image loads. The colour is empty for fully transparent images.
+func Placeholder(img image.Image) (dominantColor, blurhash string) {
+	thumb := thumbnail(img)
+	return dominant(thumb), encodeBlurhash(thumb)
+}
+
+// thumbnail scales img to fit within placeholderSize pixels square
+func thumbnail(img image.Image) *image.NRGBA {
+	bounds := img.Bounds()
+	width, height := placeholderSize, placeholderSize
+	if bounds.Dx() > bounds.Dy() {
+		height = bounds.Dy() * placeholderSize / bounds.Dx()
+	} else {
+		width = bounds.Dx() * placeholderSize / bounds.Dy()
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// dominant buckets the visible pixels by their 4 high bits per channel and returns the
+// average colour of the fullest bucket
+func dominant(img *image.NRGBA) string {
+	type bucket struct{ n, r, g, b int }
+	buckets := make(map[int]*bucket)
+	var best *bucket
+
+	for i := 0; i+3 < len(img.Pix); i += 4 {
+		r, g, b, a := int(img.Pix[i]), int(img.Pix[i+1]), int(img.Pix[i+2]), img.Pix[i+3]
+		if a < 128 {
+			continue
+		}
+		key := r>>4<<8 | g>>4<<4 | b>>4
+		bk := buckets[key]
+		if bk == nil {
+			bk = &bucket{}
+			buckets[key] = bk
+		}
+		bk.n++
+		bk.r += r
+		bk.g += g
+		bk.b += b
+		if best == nil || bk.n > best.n {
+			best = bk
+		}
+	}
+
+	if best == nil {
+		return ""
+	}
+	return fmt.Sprintf("#%02x%02x%02x", best.r/best.n, best.g/best.n, best.b/best.n)
+}
+
+// encodeBlurhash implements the encoder of https://github.com/woltapp/blurhash
+func encodeBlurhash(img *image.NRGBA) string {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	var factors [blurhashX * blurhashY][3]float64
+	for j := 0; j < blurhashY; j++ {
+		for i := 0; i < blurhashX; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			var r, g, b float64
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					basis := math.Cos(math.Pi*float64(i)*float64(x)/float64(width)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(height))
+					offset := img.PixOffset(x, y)
+					r += basis * srgbToLinear(img.Pix[offset])
+					g += basis * srgbToLinear(img.Pix[offset+1])
+					b += basis * srgbToLinear(img.Pix[offset+2])
+				}
+			}
+			scale := normalisation / float64(width*height)
+			factors[j*blurhashX+i] = [3]float64{r * scale, g * scale, b * scale}
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(base83((blurhashX-1)+(blurhashY-1)*9, 1))
+
+	maximum := 0.0
+	for _, factor := range factors[1:] {
+		for _, c := range factor {
+			maximum = math.Max(maximum, math.Abs(c))
+		}
+	}
+	quantisedMaximum := int(math.Max(0, math.Min(82, math.Floor(maximum*166-0.5))))
+	maximumValue := float64(quantisedMaximum+1) / 166
+	hash.WriteString(base83(quantisedMaximum, 1))
+
+	dc := factors[0]
+	hash.WriteString(base83(linearToSRGB(dc[0])<<16|linearToSRGB(dc[1])<<8|linearToSRGB(dc[2]), 4))
+
+	for _, factor := range factors[1:] {
+		var quantised [3]int
+		for k, c := range factor {
+			quantised[k] = int(math.Max(0, math.Min(18, math.Floor(signPow(c/maximumValue, 0.5)*9+9.5))))
+		}
+		hash.WriteString(base83(quantised[0]*19*19+quantised[1]*19+quantised[2], 2))
+	}
+	return hash.String()
+}
+
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// base83 encodes value as length base 83 digits
+func base83(value, length int) string {
+	digits := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		digits[i] = base83Chars[value%83]
+		value /= 83
+	}
+	return string(digits)
+}
+
+func srgbToLinear(value uint8) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
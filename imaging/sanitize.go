@@ -0,0 +1,202 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// Limits on uploaded images. They are checked from the image header before the pixels are
+// decoded, so small files that expand to huge bitmaps are rejected cheaply.
+const (
+	MaxDimension = 10000      // pixels per side
+	MaxPixels    = 40_000_000 // width × height
+	// MaxGIFPixels bounds width × height × frames of animated GIFs
+	MaxGIFPixels = 100_000_000
+)
+
+// uploadJPEGQuality is the quality uploads are re-encoded with, high enough to avoid visible loss
+const uploadJPEGQuality = 90
+
+var (
+	// ErrUnsupportedType is returned for files that are not JPEG, PNG, GIF or WebP images
+	ErrUnsupportedType = errors.New("not a JPEG, PNG, GIF or WebP image")
+	// ErrTooLarge is returned for images exceeding MaxDimension, MaxPixels or MaxGIFPixels
+	ErrTooLarge = errors.New("image dimensions are too large")
+	// ErrCorrupt is returned for files that look like images but cannot be decoded
+	ErrCorrupt = errors.New("image could not be decoded")
+)
+
+// Sanitized is an uploaded image that passed the checks and was re-encoded
+type Sanitized struct {
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+	// Image is the decoded image, the first frame for animated GIFs
+	Image image.Image
+}
+
+// Sniff identifies the image type from the magic bytes at the start of a file.
+// It returns "" for anything else; file names and declared types are not trusted.
+func Sniff(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF}):
+		return "image/jpeg"
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return "image/png"
+	case bytes.HasPrefix(head, []byte("GIF87a")), bytes.HasPrefix(head, []byte("GIF89a")):
+		return "image/gif"
+	case len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WEBP":
+		return "image/webp"
+	}
+	return ""
+}
+
+// Sanitize checks an uploaded image and re-encodes it, which drops EXIF and all other
+// metadata such as GPS positions. JPEGs are turned upright first because their EXIF
+// orientation is lost. WebP originals are stored as JPEG or PNG so that every browser can
+// show them; browsers with WebP support get the WebP variants made by Generate.
+func Sanitize(data []byte) (Sanitized, error) {
+	contentType := Sniff(data)
+	if contentType == "" {
+		return Sanitized{}, ErrUnsupportedType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Sanitized{}, ErrCorrupt
+	}
+	if config.Width < 1 || config.Height < 1 {
+		return Sanitized{}, ErrCorrupt
+	}
+	if config.Width > MaxDimension || config.Height > MaxDimension || config.Width*config.Height > MaxPixels {
+		return Sanitized{}, ErrTooLarge
+	}
+
+	if contentType == "image/gif" {
+		return sanitizeGIF(data, config)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Sanitized{}, ErrCorrupt
+	}
+	if contentType == "image/jpeg" {
+		img = orient(img, jpegOrientation(data))
+	}
+
+	var buf bytes.Buffer
+	switch {
+	case contentType == "image/jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: uploadJPEGQuality})
+	case contentType == "image/webp" && opaque(img):
+		contentType = "image/jpeg"
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: uploadJPEGQuality})
+	default:
+		contentType = "image/png"
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return Sanitized{}, err
+	}
+
+	bounds := img.Bounds()
+	return Sanitized{
+		Data:        buf.Bytes(),
+		ContentType: contentType,
+		Width:       bounds.Dx(),
+		Height:      bounds.Dy(),
+		Image:       img,
+	}, nil
+}
+
+// sanitizeGIF re-encodes every frame of a GIF, which drops comment and application
+// extensions, after checking the frame count keeps the decoded size in bounds
+func sanitizeGIF(data []byte, config image.Config) (Sanitized, error) {
+	frames, err := gifFrameCount(data)
+	if err != nil {
+		return Sanitized{}, ErrCorrupt
+	}
+	if frames*config.Width*config.Height > MaxGIFPixels {
+		return Sanitized{}, ErrTooLarge
+	}
+
+	decoded, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil || len(decoded.Image) == 0 {
+		return Sanitized{}, ErrCorrupt
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, decoded); err != nil {
+		return Sanitized{}, err
+	}
+	return Sanitized{
+		Data:        buf.Bytes(),
+		ContentType: "image/gif",
+		Width:       config.Width,
+		Height:      config.Height,
+		Image:       decoded.Image[0],
+	}, nil
+}
+
+// gifFrameCount counts the frames of a GIF by walking its blocks without decoding them
+func gifFrameCount(data []byte) (int, error) {
+	errTruncated := fmt.Errorf("truncated GIF")
+	if len(data) < 13 {
+		return 0, errTruncated
+	}
+	pos := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << ((flags & 0x07) + 1)
+	}
+
+	// skipSubBlocks moves past a sequence of data sub-blocks ending in an empty one
+	skipSubBlocks := func() error {
+		for {
+			if pos >= len(data) {
+				return errTruncated
+			}
+			size := int(data[pos])
+			pos++
+			if size == 0 {
+				return nil
+			}
+			pos += size
+		}
+	}
+
+	frames := 0
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // extension: label, then sub-blocks
+			pos += 2
+			if err := skipSubBlocks(); err != nil {
+				return 0, err
+			}
+		case 0x2C: // image descriptor, optional local color table, LZW code size, sub-blocks
+			if pos+10 > len(data) {
+				return 0, errTruncated
+			}
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << ((flags & 0x07) + 1)
+			}
+			pos++
+			if err := skipSubBlocks(); err != nil {
+				return 0, err
+			}
+			frames++
+		case 0x3B: // trailer
+			return frames, nil
+		default:
+			return 0, fmt.Errorf("unexpected GIF block 0x%02x", data[pos])
+		}
+	}
+	return frames, nil
+}
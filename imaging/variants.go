@@ -0,0 +1,137 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	models "minna-style-hub/model"
+	"minna-style-hub/storage"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // register WebP for image.Decode
+)
+
+// Widths are the widths in pixels of the resized variants. Images are never upscaled,
+// so only the widths below the original width are generated.
+var Widths = []int{200, 400, 800, 1600}
+
+// WebPType is the content type of the WebP variants made next to the JPEG or PNG ones
+const WebPType = "image/webp"
+
+// jpegQuality is the quality of JPEG variants
+const jpegQuality = 82
+
+// resizable lists the uploaded types variants are made of. Animated GIFs would lose
+// their animation, so GIFs are served as uploaded.
+var resizable = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+}
+
+// Resizable reports whether variants are generated for images of the content type
+func Resizable(contentType string) bool {
+	return resizable[contentType]
+}
+
+// VariantKey returns the storage key of the variant of an asset with the given width and extension
+func VariantKey(assetID string, width int, ext string) string {
+	return fmt.Sprintf("assets/%s/w%d%s", assetID, width, ext)
+}
+
+// Resize scales img to width, keeping the aspect ratio
+func Resize(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// opaque reports whether img has no transparent pixels
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// Encode writes img as JPEG, or as PNG when it has transparency JPEG cannot hold.
+// It returns the content type and file extension used.
+func Encode(img image.Image) (data []byte, contentType, ext string, err error) {
+	var buf bytes.Buffer
+	if opaque(img) {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+		return buf.Bytes(), "image/jpeg", ".jpg", err
+	}
+	err = png.Encode(&buf, img)
+	return buf.Bytes(), "image/png", ".png", err
+}
+
+// Generate stores the resized variants of an uploaded image and returns them, smallest first.
+// Every width has a JPEG or PNG variant, see Encode, followed by a WebP one for the browsers
+// that support it. Images narrower than the smallest width get no variants.
+func Generate(ctx context.Context, store storage.Storage, asset models.Asset) ([]models.AssetVariant, error) {
+	if !Resizable(asset.ContentType) {
+		return nil, nil
+	}
+
+	src, err := Load(ctx, store, asset.Key)
+	if err != nil {
+		return nil, err
+	}
+	return GenerateFrom(ctx, store, asset, src)
+}
+
+// Load reads and decodes the image stored under key
+func Load(ctx context.Context, store storage.Storage, key string) (image.Image, error) {
+	body, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	img, _, err := image.Decode(body)
+	return img, err
+}
+
+// GenerateFrom is Generate for an image that has already been decoded
+func GenerateFrom(ctx context.Context, store storage.Storage, asset models.Asset, src image.Image) ([]models.AssetVariant, error) {
+	if !Resizable(asset.ContentType) {
+		return nil, nil
+	}
+
+	var variants []models.AssetVariant
+	for _, width := range Widths {
+		if width >= src.Bounds().Dx() {
+			break
+		}
+		resized := Resize(src, width)
+		data, contentType, ext, err := Encode(resized)
+		if err != nil {
+			return nil, err
+		}
+		webpData, err := EncodeWebP(resized)
+		if err != nil {
+			return nil, err
+		}
+
+		height := resized.Bounds().Dy()
+		variant := models.AssetVariant{Width: width, Height: height, ContentType: contentType, Key: VariantKey(asset.ID, width, ext)}
+		webpVariant := models.AssetVariant{Width: width, Height: height, ContentType: WebPType, Key: VariantKey(asset.ID, width, ".webp")}
+		if err := store.Put(ctx, variant.Key, bytes.NewReader(data), contentType); err != nil {
+			return nil, err
+		}
+		if err := store.Put(ctx, webpVariant.Key, bytes.NewReader(webpData), WebPType); err != nil {
+			return nil, err
+		}
+		variants = append(variants, variant, webpVariant)
+	}
+	return variants, nil
+}
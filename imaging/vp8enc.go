@@ -0,0 +1,822 @@
+package imaging
+
+import "math"
+
+// The encoder below writes a lossy VP8 key frame as specified in RFC 6386. It keeps to
+// the subset a still image needs: one segment, one token partition and whole macroblock
+// prediction of luma and chroma. Every macroblock is reconstructed exactly as a decoder
+// will, so the prediction of the next ones starts from the same pixels.
+
+// Dimensions of the token probability tables
+const (
+	vp8Planes   = 4
+	vp8Bands    = 8
+	vp8Contexts = 3
+	vp8Probs    = 11
+)
+
+// Block types, which select the token probabilities of section 13.3
+const (
+	planeYAfterY2 = 0
+	planeY2       = 1
+	planeUV       = 2
+)
+
+// Intra prediction modes of section 12.2, in the order of their codes
+const (
+	predDC = iota
+	predV
+	predH
+	predTM
+)
+
+// Blocks of a macroblock in the order their tokens are written: 16 luma, 4 U, 4 V and
+// the block holding the DC coefficients of the luma blocks
+const (
+	blockU  = 16
+	blockV  = 20
+	blockY2 = 24
+)
+
+var (
+	// coeffBands maps a coefficient position to its band, section 13.3
+	coeffBands = [17]uint8{0, 1, 2, 3, 6, 4, 5, 6, 6, 6, 6, 6, 6, 6, 6, 7, 0}
+	// zigzag is the order coefficients are written in, section 13.3
+	zigzag = [16]uint8{0, 1, 4, 8, 5, 2, 3, 6, 9, 12, 13, 10, 7, 11, 14, 15}
+	// Probabilities of the extra bits of the token categories 3 to 6, section 13.2
+	catExtraProbs = [4][]uint8{
+		{173, 148, 140},
+		{176, 155, 140, 135},
+		{180, 157, 141, 134, 130},
+		{254, 254, 243, 230, 196, 177, 153, 140, 133, 130, 129},
+	}
+)
+
+// maxLevel is the largest quantized coefficient written; larger ones are clamped
+const maxLevel = 2048
+
+// boolEncoder is the boolean entropy encoder of section 7 of RFC 6386
+type boolEncoder struct {
+	buf      []byte
+	rng      uint32
+	bottom   uint32
+	bitCount int
+}
+
+func newBoolEncoder() *boolEncoder {
+	return &boolEncoder{rng: 255, bitCount: 24}
+}
+
+// putBit writes bit, whose probability of being false is prob/256
+func (e *boolEncoder) putBit(bit bool, prob uint8) {
+	split := 1 + (e.rng-1)*uint32(prob)>>8
+	if bit {
+		e.bottom += split
+		e.rng -= split
+	} else {
+		e.rng = split
+	}
+	for e.rng < 128 {
+		e.rng <<= 1
+		if e.bottom&(1<<31) != 0 {
+			e.carry()
+		}
+		e.bottom <<= 1
+		e.bitCount--
+		if e.bitCount == 0 {
+			e.buf = append(e.buf, byte(e.bottom>>24))
+			e.bottom &= 1<<24 - 1
+			e.bitCount = 8
+		}
+	}
+}
+
+// carry adds one to the bytes written so far
+func (e *boolEncoder) carry() {
+	for i := len(e.buf) - 1; i >= 0; i-- {
+		e.buf[i]++
+		if e.buf[i] != 0 {
+			return
+		}
+	}
+}
+
+// putLiteral writes the n low bits of v, most significant first
+func (e *boolEncoder) putLiteral(v uint32, n int) {
+	for n--; n >= 0; n-- {
+		e.putBit(v>>uint(n)&1 != 0, 128)
+	}
+}
+
+// bytes pads the output so a decoder can read every bit written and returns it
+func (e *boolEncoder) bytes() []byte {
+	for i := 0; i < 32; i++ {
+		e.putBit(false, 128)
+	}
+	return e.buf
+}
+
+// vp8Plane is a plane of samples padded to whole macroblocks
+type vp8Plane struct {
+	pix    []uint8
+	stride int
+}
+
+func newVP8Plane(width, height int) vp8Plane {
+	return vp8Plane{pix: make([]uint8, width*height), stride: width}
+}
+
+func (p *vp8Plane) at(x, y int) int32 {
+	return int32(p.pix[y*p.stride+x])
+}
+
+// vp8Quantizer holds the step sizes of the DC and AC coefficients of a block type and the
+// rounding of each, in 1/256 of the step
+type vp8Quantizer struct {
+	step [2]int32
+	bias [2]int32
+}
+
+// quantize returns the quantized level of coefficient c at position i, 0 being the DC
+func (q *vp8Quantizer) quantize(c int32, i int) int16 {
+	k := 1
+	if i == 0 {
+		k = 0
+	}
+	sign := int32(1)
+	if c < 0 {
+		sign, c = -1, -c
+	}
+	level := (c*256 + q.step[k]*q.bias[k]) / (q.step[k] * 256)
+	if level > maxLevel {
+		level = maxLevel
+	}
+	return int16(sign * level)
+}
+
+func (q *vp8Quantizer) dequantize(level int16, i int) int32 {
+	if i == 0 {
+		return int32(level) * q.step[0]
+	}
+	return int32(level) * q.step[1]
+}
+
+// vp8Macroblock is what is written of a macroblock
+type vp8Macroblock struct {
+	yMode, uvMode uint8
+	// skip is set when all coefficients are zero
+	skip bool
+	// coeffs are the quantized coefficients of each block in raster order
+	coeffs [25][16]int16
+}
+
+// vp8Encoder encodes one frame
+type vp8Encoder struct {
+	width, height int
+	mbw, mbh      int
+	qIndex        int
+	filterLevel   int
+	// src are the Y, U and V planes to encode and rec those a decoder reconstructs
+	src, rec     [3]vp8Plane
+	y1, y2, uv   vp8Quantizer
+	mbs          []vp8Macroblock
+	probs        [vp8Planes][vp8Bands][vp8Contexts][vp8Probs]uint8
+	skipProb     uint8
+	useSkipProb  bool
+	updatedProbs [vp8Planes][vp8Bands][vp8Contexts][vp8Probs]bool
+}
+
+// encodeVP8 compresses the Y, U and V planes of an image of the given size, which are padded
+// to whole macroblocks, as a VP8 key frame with the quantizer index qIndex from 0 to 127.
+// filterLevel is the strength of the loop filter that smooths block edges when decoding.
+func encodeVP8(y, u, v vp8Plane, width, height, qIndex, filterLevel int) []byte {
+	e := &vp8Encoder{
+		width:       width,
+		height:      height,
+		mbw:         (width + 15) / 16,
+		mbh:         (height + 15) / 16,
+		qIndex:      qIndex,
+		filterLevel: filterLevel,
+		src:         [3]vp8Plane{y, u, v},
+		probs:       defaultCoeffProbs,
+	}
+	e.rec = [3]vp8Plane{
+		newVP8Plane(y.stride, len(y.pix)/y.stride),
+		newVP8Plane(u.stride, len(u.pix)/u.stride),
+		newVP8Plane(v.stride, len(v.pix)/v.stride),
+	}
+
+	uvDCIndex := qIndex
+	if uvDCIndex > 117 {
+		uvDCIndex = 117
+	}
+	y2AC := int32(acQuantSteps[qIndex]) * 155 / 100
+	if y2AC < 8 {
+		y2AC = 8
+	}
+	e.y1 = vp8Quantizer{step: [2]int32{int32(dcQuantSteps[qIndex]), int32(acQuantSteps[qIndex])}, bias: [2]int32{96, 110}}
+	e.y2 = vp8Quantizer{step: [2]int32{int32(dcQuantSteps[qIndex]) * 2, y2AC}, bias: [2]int32{96, 108}}
+	e.uv = vp8Quantizer{step: [2]int32{int32(dcQuantSteps[uvDCIndex]), int32(acQuantSteps[qIndex])}, bias: [2]int32{110, 115}}
+
+	e.mbs = make([]vp8Macroblock, e.mbw*e.mbh)
+	skipped := 0
+	for mby := 0; mby < e.mbh; mby++ {
+		for mbx := 0; mbx < e.mbw; mbx++ {
+			mb := &e.mbs[mby*e.mbw+mbx]
+			e.encodeLuma(mb, mbx, mby)
+			e.encodeChroma(mb, mbx, mby)
+			mb.skip = mb.coeffs == [25][16]int16{}
+			if mb.skip {
+				skipped++
+			}
+		}
+	}
+	if skipped > 0 {
+		e.useSkipProb = true
+		e.skipProb = probability(len(e.mbs)-skipped, skipped)
+	}
+
+	// Token probabilities are adapted to the frame from what a first pass counts
+	var counts [vp8Planes][vp8Bands][vp8Contexts][vp8Probs][2]uint32
+	e.writeTokens(&tokenWriter{counts: &counts})
+	e.updateProbs(&counts)
+
+	tokens := newBoolEncoder()
+	e.writeTokens(&tokenWriter{enc: tokens, probs: &e.probs})
+	return e.frame(e.writeHeader(), tokens.bytes())
+}
+
+// probability returns the probability of a bit being false, in 1/256, from the counts of
+// both values
+func probability(zeros, ones int) uint8 {
+	total := zeros + ones
+	if total == 0 {
+		return 128
+	}
+	p := (zeros*256 + total/2) / total
+	if p < 1 {
+		return 1
+	}
+	if p > 255 {
+		return 255
+	}
+	return uint8(p)
+}
+
+// predict fills pred with the prediction in mode of the size×size block at x, y of plane,
+// from the reconstructed pixels above and to the left, section 12.2. Edges outside the
+// frame read as 127 above and 129 to the left.
+func (e *vp8Encoder) predict(plane, x, y, size int, mode uint8, pred []int32) {
+	rec := &e.rec[plane]
+	var top, left [16]int32
+	corner := int32(127)
+	for i := 0; i < size; i++ {
+		top[i], left[i] = 127, 129
+		if y > 0 {
+			top[i] = rec.at(x+i, y-1)
+		}
+		if x > 0 {
+			left[i] = rec.at(x-1, y+i)
+		}
+	}
+	if y > 0 {
+		corner = 129
+		if x > 0 {
+			corner = rec.at(x-1, y-1)
+		}
+	}
+
+	switch mode {
+	case predDC:
+		sum, n := int32(0), int32(0)
+		for i := 0; i < size; i++ {
+			if y > 0 {
+				sum += top[i]
+			}
+			if x > 0 {
+				sum += left[i]
+			}
+		}
+		if y > 0 {
+			n += int32(size)
+		}
+		if x > 0 {
+			n += int32(size)
+		}
+		dc := int32(128)
+		if n > 0 {
+			dc = (sum + n/2) / n
+		}
+		for i := range pred[:size*size] {
+			pred[i] = dc
+		}
+	case predV:
+		for j := 0; j < size; j++ {
+			copy(pred[j*size:(j+1)*size], top[:size])
+		}
+	case predH:
+		for j := 0; j < size; j++ {
+			for i := 0; i < size; i++ {
+				pred[j*size+i] = left[j]
+			}
+		}
+	case predTM:
+		for j := 0; j < size; j++ {
+			for i := 0; i < size; i++ {
+				pred[j*size+i] = clip255(left[j] + top[i] - corner)
+			}
+		}
+	}
+}
+
+// bestMode returns the prediction mode of the size×size blocks at x, y of planes that
+// leaves the smallest squared error, with its prediction
+func (e *vp8Encoder) bestMode(planes []int, x, y, size int, preds [][]int32) uint8 {
+	best, bestErr := uint8(predDC), int64(math.MaxInt64)
+	candidate := make([][]int32, len(planes))
+	for i := range candidate {
+		candidate[i] = make([]int32, size*size)
+	}
+	for mode := uint8(predDC); mode <= predTM; mode++ {
+		var sse int64
+		for i, plane := range planes {
+			e.predict(plane, x, y, size, mode, candidate[i])
+			src := &e.src[plane]
+			for j := 0; j < size; j++ {
+				for k := 0; k < size; k++ {
+					d := int64(src.at(x+k, y+j) - candidate[i][j*size+k])
+					sse += d * d
+				}
+			}
+		}
+		if sse < bestErr {
+			best, bestErr = mode, sse
+			for i := range planes {
+				copy(preds[i], candidate[i])
+			}
+		}
+	}
+	return best
+}
+
+// encodeLuma predicts the luma of a macroblock, quantizes the residual and reconstructs it
+func (e *vp8Encoder) encodeLuma(mb *vp8Macroblock, mbx, mby int) {
+	x, y := mbx*16, mby*16
+	pred := make([]int32, 16*16)
+	mb.yMode = e.bestMode([]int{0}, x, y, 16, [][]int32{pred})
+
+	var coeffs [16][16]int32
+	var dcs [16]int32
+	for b := 0; b < 16; b++ {
+		bx, by := b%4*4, b/4*4
+		var residual [16]int32
+		for j := 0; j < 4; j++ {
+			for i := 0; i < 4; i++ {
+				residual[j*4+i] = e.src[0].at(x+bx+i, y+by+j) - pred[(by+j)*16+bx+i]
+			}
+		}
+		coeffs[b] = fdct(residual)
+		dcs[b] = coeffs[b][0]
+	}
+
+	// The DC coefficients are transformed once more and quantized as a block of their own
+	y2 := fwht(dcs)
+	var y2Dequant [16]int32
+	for i, c := range y2 {
+		mb.coeffs[blockY2][i] = e.y2.quantize(c, i)
+		y2Dequant[i] = e.y2.dequantize(mb.coeffs[blockY2][i], i)
+	}
+	dcs = iwht(y2Dequant)
+
+	for b := 0; b < 16; b++ {
+		dequant := [16]int32{dcs[b]}
+		for i := 1; i < 16; i++ {
+			mb.coeffs[b][i] = e.y1.quantize(coeffs[b][i], i)
+			dequant[i] = e.y1.dequantize(mb.coeffs[b][i], i)
+		}
+		bx, by := b%4*4, b/4*4
+		e.reconstruct(0, x+bx, y+by, pred[by*16+bx:], 16, idct(dequant))
+	}
+}
+
+// encodeChroma is encodeLuma for both chroma planes, which share their prediction mode
+func (e *vp8Encoder) encodeChroma(mb *vp8Macroblock, mbx, mby int) {
+	x, y := mbx*8, mby*8
+	preds := [][]int32{make([]int32, 8*8), make([]int32, 8*8)}
+	mb.uvMode = e.bestMode([]int{1, 2}, x, y, 8, preds)
+
+	for p, first := range []int{blockU, blockV} {
+		plane, pred := p+1, preds[p]
+		for b := 0; b < 4; b++ {
+			bx, by := b%2*4, b/2*4
+			var residual [16]int32
+			for j := 0; j < 4; j++ {
+				for i := 0; i < 4; i++ {
+					residual[j*4+i] = e.src[plane].at(x+bx+i, y+by+j) - pred[(by+j)*8+bx+i]
+				}
+			}
+			coeffs := fdct(residual)
+			var dequant [16]int32
+			for i, c := range coeffs {
+				mb.coeffs[first+b][i] = e.uv.quantize(c, i)
+				dequant[i] = e.uv.dequantize(mb.coeffs[first+b][i], i)
+			}
+			e.reconstruct(plane, x+bx, y+by, pred[by*8+bx:], 8, idct(dequant))
+		}
+	}
+}
+
+// reconstruct stores the 4×4 block at x, y of a plane as prediction plus residual
+func (e *vp8Encoder) reconstruct(plane, x, y int, pred []int32, predStride int, residual [16]int32) {
+	rec := &e.rec[plane]
+	for j := 0; j < 4; j++ {
+		for i := 0; i < 4; i++ {
+			rec.pix[(y+j)*rec.stride+x+i] = uint8(clip255(pred[j*predStride+i] + residual[j*4+i]))
+		}
+	}
+}
+
+func clip255(v int32) int32 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return v
+}
+
+// fdct is the forward DCT of libvpx, the counterpart of idct
+func fdct(in [16]int32) [16]int32 {
+	var tmp, out [16]int32
+	for i := 0; i < 4; i++ {
+		r := in[i*4 : i*4+4]
+		a := (r[0] + r[3]) * 8
+		b := (r[1] + r[2]) * 8
+		c := (r[1] - r[2]) * 8
+		d := (r[0] - r[3]) * 8
+		tmp[i*4+0] = a + b
+		tmp[i*4+2] = a - b
+		tmp[i*4+1] = (c*2217 + d*5352 + 14500) >> 12
+		tmp[i*4+3] = (d*2217 - c*5352 + 7500) >> 12
+	}
+	for i := 0; i < 4; i++ {
+		a := tmp[i] + tmp[12+i]
+		b := tmp[4+i] + tmp[8+i]
+		c := tmp[4+i] - tmp[8+i]
+		d := tmp[i] - tmp[12+i]
+		out[i] = (a + b + 7) >> 4
+		out[8+i] = (a - b + 7) >> 4
+		out[4+i] = (c*2217 + d*5352 + 12000) >> 16
+		if d != 0 {
+			out[4+i]++
+		}
+		out[12+i] = (d*2217 - c*5352 + 51000) >> 16
+	}
+	return out
+}
+
+// idct is the inverse DCT of section 14.3, which decoders must match exactly
+func idct(in [16]int32) [16]int32 {
+	const (
+		c1 = 85627 // 65536 * cos(pi/8) * sqrt(2)
+		c2 = 35468 // 65536 * sin(pi/8) * sqrt(2)
+	)
+	var tmp [16]int32
+	for i := 0; i < 4; i++ {
+		a := in[i] + in[8+i]
+		b := in[i] - in[8+i]
+		c := (in[4+i]*c2)>>16 - (in[12+i]*c1)>>16
+		d := (in[4+i]*c1)>>16 + (in[12+i]*c2)>>16
+		tmp[i*4+0] = a + d
+		tmp[i*4+1] = b + c
+		tmp[i*4+2] = b - c
+		tmp[i*4+3] = a - d
+	}
+	var out [16]int32
+	for j := 0; j < 4; j++ {
+		dc := tmp[j] + 4
+		a := dc + tmp[8+j]
+		b := dc - tmp[8+j]
+		c := (tmp[4+j]*c2)>>16 - (tmp[12+j]*c1)>>16
+		d := (tmp[4+j]*c1)>>16 + (tmp[12+j]*c2)>>16
+		out[j*4+0] = (a + d) >> 3
+		out[j*4+1] = (b + c) >> 3
+		out[j*4+2] = (b - c) >> 3
+		out[j*4+3] = (a - d) >> 3
+	}
+	return out
+}
+
+// fwht is the forward Walsh-Hadamard transform of libvpx, the counterpart of iwht
+func fwht(in [16]int32) [16]int32 {
+	var tmp, out [16]int32
+	for i := 0; i < 4; i++ {
+		r := in[i*4 : i*4+4]
+		a := (r[0] + r[2]) * 4
+		d := (r[1] + r[3]) * 4
+		c := (r[1] - r[3]) * 4
+		b := (r[0] - r[2]) * 4
+		tmp[i*4+0] = a + d
+		if a != 0 {
+			tmp[i*4+0]++
+		}
+		tmp[i*4+1] = b + c
+		tmp[i*4+2] = b - c
+		tmp[i*4+3] = a - d
+	}
+	for i := 0; i < 4; i++ {
+		a := tmp[i] + tmp[8+i]
+		d := tmp[4+i] + tmp[12+i]
+		c := tmp[4+i] - tmp[12+i]
+		b := tmp[i] - tmp[8+i]
+		for k, v := range [4]int32{a + d, b + c, b - c, a - d} {
+			if v < 0 {
+				v++
+			}
+			out[k*4+i] = (v + 3) >> 3
+		}
+	}
+	return out
+}
+
+// iwht is the inverse Walsh-Hadamard transform of section 14.3
+func iwht(in [16]int32) [16]int32 {
+	var tmp, out [16]int32
+	for i := 0; i < 4; i++ {
+		a0 := in[i] + in[12+i]
+		a1 := in[4+i] + in[8+i]
+		a2 := in[4+i] - in[8+i]
+		a3 := in[i] - in[12+i]
+		tmp[i] = a0 + a1
+		tmp[8+i] = a0 - a1
+		tmp[4+i] = a3 + a2
+		tmp[12+i] = a3 - a2
+	}
+	for i := 0; i < 4; i++ {
+		dc := tmp[i*4] + 3
+		a0 := dc + tmp[i*4+3]
+		a1 := tmp[i*4+1] + tmp[i*4+2]
+		a2 := tmp[i*4+1] - tmp[i*4+2]
+		a3 := dc - tmp[i*4+3]
+		out[i*4+0] = (a0 + a1) >> 3
+		out[i*4+1] = (a3 + a2) >> 3
+		out[i*4+2] = (a0 - a1) >> 3
+		out[i*4+3] = (a3 - a2) >> 3
+	}
+	return out
+}
+
+// tokenWriter writes the coefficient tokens with enc, or only counts the values of the
+// adaptive bits when enc is nil
+type tokenWriter struct {
+	enc    *boolEncoder
+	probs  *[vp8Planes][vp8Bands][vp8Contexts][vp8Probs]uint8
+	counts *[vp8Planes][vp8Bands][vp8Contexts][vp8Probs][2]uint32
+}
+
+// put writes a bit coded with the token probability node of plane, band and ctx
+func (t *tokenWriter) put(bit bool, plane int, band uint8, ctx, node int) {
+	if t.enc == nil {
+		t.counts[plane][band][ctx][node][btoi(bit)]++
+		return
+	}
+	t.enc.putBit(bit, t.probs[plane][band][ctx][node])
+}
+
+// putFixed writes a bit with a probability that is not adapted
+func (t *tokenWriter) putFixed(bit bool, prob uint8) {
+	if t.enc != nil {
+		t.enc.putBit(bit, prob)
+	}
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// writeBlock writes the coefficients of a block from position first on, section 13.
+// ctx is the number of neighbouring blocks with coefficients; it returns 1 when this
+// block has any.
+func (t *tokenWriter) writeBlock(coeffs *[16]int16, plane, ctx, first int) int {
+	last := -1
+	for i := 15; i >= first; i-- {
+		if coeffs[zigzag[i]] != 0 {
+			last = i
+			break
+		}
+	}
+	band := coeffBands[first]
+	if last < 0 {
+		t.put(false, plane, band, ctx, 0)
+		return 0
+	}
+	t.put(true, plane, band, ctx, 0)
+
+	for n := first; ; {
+		level := int32(coeffs[zigzag[n]])
+		negative := level < 0
+		if negative {
+			level = -level
+		}
+		n++
+		if level == 0 {
+			t.put(false, plane, band, ctx, 1)
+			band, ctx = coeffBands[n], 0
+			continue
+		}
+
+		t.put(true, plane, band, ctx, 1)
+		if level == 1 {
+			t.put(false, plane, band, ctx, 2)
+			ctx = 1
+		} else {
+			t.put(true, plane, band, ctx, 2)
+			t.writeLevel(level, plane, band, ctx)
+			ctx = 2
+		}
+		t.putFixed(negative, 128)
+
+		if n == 16 {
+			return 1
+		}
+		band = coeffBands[n]
+		if n > last {
+			t.put(false, plane, band, ctx, 0)
+			return 1
+		}
+		t.put(true, plane, band, ctx, 0)
+	}
+}
+
+// writeLevel writes the token of a level above 1 and its extra bits
+func (t *tokenWriter) writeLevel(level int32, plane int, band uint8, ctx int) {
+	switch {
+	case level <= 4:
+		t.put(false, plane, band, ctx, 3)
+		if level == 2 {
+			t.put(false, plane, band, ctx, 4)
+			return
+		}
+		t.put(true, plane, band, ctx, 4)
+		t.put(level == 4, plane, band, ctx, 5)
+	case level <= 10:
+		t.put(true, plane, band, ctx, 3)
+		t.put(false, plane, band, ctx, 6)
+		if level <= 6 {
+			t.put(false, plane, band, ctx, 7)
+			t.putFixed(level == 6, 159)
+			return
+		}
+		t.put(true, plane, band, ctx, 7)
+		t.putFixed((level-7)&2 != 0, 165)
+		t.putFixed((level-7)&1 != 0, 145)
+	default:
+		t.put(true, plane, band, ctx, 3)
+		t.put(true, plane, band, ctx, 6)
+		cat := 3
+		for cat > 0 && level < 3+8<<uint(cat) {
+			cat--
+		}
+		t.put(cat >= 2, plane, band, ctx, 8)
+		t.put(cat&1 != 0, plane, band, ctx, 9+cat/2)
+		extra := level - (3 + 8<<uint(cat))
+		probs := catExtraProbs[cat]
+		for i, prob := range probs {
+			t.putFixed(extra>>uint(len(probs)-1-i)&1 != 0, prob)
+		}
+	}
+}
+
+// writeTokens writes the coefficients of all macroblocks, tracking which neighbouring
+// blocks have coefficients as the contexts of section 13.3
+func (e *vp8Encoder) writeTokens(t *tokenWriter) {
+	// Per macroblock column the flags of the bottom row of blocks, and those of the
+	// right column of the macroblock to the left: 4 luma, 2 U, 2 V and the luma DC
+	top := make([][9]int, e.mbw)
+	for mby := 0; mby < e.mbh; mby++ {
+		var left [9]int
+		for mbx := 0; mbx < e.mbw; mbx++ {
+			mb := &e.mbs[mby*e.mbw+mbx]
+			above := &top[mbx]
+			if mb.skip {
+				*above, left = [9]int{}, [9]int{}
+				continue
+			}
+
+			nz := t.writeBlock(&mb.coeffs[blockY2], planeY2, above[8]+left[8], 0)
+			above[8], left[8] = nz, nz
+			for b := 0; b < 16; b++ {
+				x, y := b%4, b/4
+				nz := t.writeBlock(&mb.coeffs[b], planeYAfterY2, above[x]+left[y], 1)
+				above[x], left[y] = nz, nz
+			}
+			for b := 0; b < 8; b++ {
+				x, y := 4+b/4*2+b%2, 4+b/4*2+b%4/2
+				nz := t.writeBlock(&mb.coeffs[blockU+b], planeUV, above[x]+left[y], 0)
+				above[x], left[y] = nz, nz
+			}
+		}
+	}
+}
+
+// updateProbs replaces the token probabilities for which sending a new one in the frame
+// header costs fewer bits than it saves
+func (e *vp8Encoder) updateProbs(counts *[vp8Planes][vp8Bands][vp8Contexts][vp8Probs][2]uint32) {
+	cost := func(prob uint8, bit int) float64 {
+		p := float64(prob) / 256
+		if bit == 1 {
+			p = 1 - p
+		}
+		return -math.Log2(p)
+	}
+	for i := range e.probs {
+		for j := range e.probs[i] {
+			for k := range e.probs[i][j] {
+				for l, old := range e.probs[i][j][k] {
+					c := counts[i][j][k][l]
+					updated := probability(int(c[0]), int(c[1]))
+					upd := coeffUpdateProbs[i][j][k][l]
+					oldBits := float64(c[0])*cost(old, 0) + float64(c[1])*cost(old, 1) + cost(upd, 0)
+					newBits := float64(c[0])*cost(updated, 0) + float64(c[1])*cost(updated, 1) + cost(upd, 1) + 8
+					if newBits < oldBits {
+						e.probs[i][j][k][l] = updated
+						e.updatedProbs[i][j][k][l] = true
+					}
+				}
+			}
+		}
+	}
+}
+
+// writeHeader writes the first partition: the frame header of section 9 and the
+// prediction modes of the macroblocks
+func (e *vp8Encoder) writeHeader() []byte {
+	h := newBoolEncoder()
+	h.putLiteral(0, 1) // color space
+	h.putLiteral(0, 1) // clamping required
+	h.putLiteral(0, 1) // no segmentation
+	h.putLiteral(0, 1) // normal loop filter
+	h.putLiteral(uint32(e.filterLevel), 6)
+	h.putLiteral(0, 3) // sharpness
+	h.putLiteral(0, 1) // no loop filter adjustments
+	h.putLiteral(0, 2) // one token partition
+	h.putLiteral(uint32(e.qIndex), 7)
+	h.putLiteral(0, 5) // no quantizer deltas
+	h.putLiteral(0, 1) // refresh entropy probabilities
+
+	for i := range e.probs {
+		for j := range e.probs[i] {
+			for k := range e.probs[i][j] {
+				for l, prob := range e.probs[i][j][k] {
+					updated := e.updatedProbs[i][j][k][l]
+					h.putBit(updated, coeffUpdateProbs[i][j][k][l])
+					if updated {
+						h.putLiteral(uint32(prob), 8)
+					}
+				}
+			}
+		}
+	}
+
+	h.putLiteral(uint32(btoi(e.useSkipProb)), 1)
+	if e.useSkipProb {
+		h.putLiteral(uint32(e.skipProb), 8)
+	}
+
+	for i := range e.mbs {
+		mb := &e.mbs[i]
+		if e.useSkipProb {
+			h.putBit(mb.skip, e.skipProb)
+		}
+		h.putBit(true, 145) // 16×16 luma prediction
+		h.putBit(mb.yMode >= predH, 156)
+		if mb.yMode < predH {
+			h.putBit(mb.yMode == predV, 163)
+		} else {
+			h.putBit(mb.yMode == predTM, 128)
+		}
+		h.putBit(mb.uvMode != predDC, 142)
+		if mb.uvMode != predDC {
+			h.putBit(mb.uvMode != predV, 114)
+			if mb.uvMode != predV {
+				h.putBit(mb.uvMode == predTM, 183)
+			}
+		}
+	}
+	return h.bytes()
+}
+
+// frame assembles the key frame of section 9.1 from its two partitions
+func (e *vp8Encoder) frame(header, tokens []byte) []byte {
+	tag := uint32(len(header))<<5 | 1<<4 // key frame, version 0, shown
+	frame := make([]byte, 0, 10+len(header)+len(tokens))
+	frame = append(frame, byte(tag), byte(tag>>8), byte(tag>>16))
+	frame = append(frame, 0x9d, 0x01, 0x2a)
+	frame = append(frame, byte(e.width), byte(e.width>>8), byte(e.height), byte(e.height>>8))
+	frame = append(frame, header...)
+	return append(frame, tokens...)
+}
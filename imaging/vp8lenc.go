@@ -0,0 +1,384 @@
+package imaging
+
+import "sort"
+
+// The alpha channel of a lossy WebP is compressed with the lossless format, see
+// https://developers.google.com/speed/webp/docs/webp_lossless_bitstream_specification.
+// The encoder below only uses what suits alpha: a spatial filter from the ALPH chunk,
+// prefix codes and backward references to the pixel on the left or above.
+
+// Alphabet sizes of the prefix codes, in the order they are written
+const (
+	alphabetGreen    = 256 + 24
+	alphabetColor    = 256
+	alphabetDistance = 40
+	alphabetLengths  = 19
+)
+
+// Longest codes of the prefix codes of the pixels and of the code lengths
+const (
+	maxCodeLength       = 15
+	maxLengthCodeLength = 7
+)
+
+// Longest and shortest backward reference written
+const (
+	maxCopyLength = 4096
+	minCopyLength = 3
+)
+
+// Distance codes of the pixel above and the pixel on the left, section 4.2.2
+const (
+	distanceAbove = 0
+	distanceLeft  = 1
+)
+
+// codeLengthOrder is the order the lengths of the code length code are written in
+var codeLengthOrder = [alphabetLengths]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// bitWriter writes bits starting from the least significant one of each byte
+type bitWriter struct {
+	buf   []byte
+	bits  uint64
+	nBits uint
+}
+
+// write writes the n low bits of v
+func (w *bitWriter) write(v uint32, n uint) {
+	w.bits |= uint64(v) << w.nBits
+	w.nBits += n
+	for w.nBits >= 8 {
+		w.buf = append(w.buf, byte(w.bits))
+		w.bits >>= 8
+		w.nBits -= 8
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.nBits > 0 {
+		w.buf = append(w.buf, byte(w.bits))
+		w.bits, w.nBits = 0, 0
+	}
+	return w.buf
+}
+
+// prefixCode is a canonical prefix code; symbols with a zero length are not used
+type prefixCode struct {
+	lengths []uint8
+	// codes are bit reversed, as they are read one bit at a time
+	codes []uint16
+	// single is set when only one symbol is used, which then takes no bits
+	single bool
+}
+
+// newPrefixCode builds the optimal code for the counts of each symbol with codes of at
+// most maxLength bits
+func newPrefixCode(counts []uint32, maxLength int) prefixCode {
+	code := prefixCode{lengths: make([]uint8, len(counts)), codes: make([]uint16, len(counts))}
+
+	type node struct {
+		count       uint32
+		left, right int
+	}
+	var used []int
+	for symbol, count := range counts {
+		if count > 0 {
+			used = append(used, symbol)
+		}
+	}
+	if len(used) <= 1 {
+		for _, symbol := range used {
+			code.lengths[symbol] = 1
+		}
+		code.single = true
+		return code
+	}
+
+	// Codes too long are avoided by flattening the counts until none is
+	for bias := uint32(0); ; bias = 2*bias + 1 {
+		nodes := make([]node, 0, 2*len(used))
+		for _, symbol := range used {
+			nodes = append(nodes, node{count: counts[symbol] + bias, left: -1, right: -1})
+		}
+		leaves := make([]int, len(used))
+		for i := range leaves {
+			leaves[i] = i
+		}
+		sort.SliceStable(leaves, func(i, j int) bool { return nodes[leaves[i]].count < nodes[leaves[j]].count })
+
+		// Two queues merge the leaves and the nodes in order of increasing count
+		merged := len(nodes)
+		take := func() int {
+			if len(leaves) > 0 && (merged == len(nodes) || nodes[leaves[0]].count <= nodes[merged].count) {
+				n := leaves[0]
+				leaves = leaves[1:]
+				return n
+			}
+			merged++
+			return merged - 1
+		}
+		for len(leaves)+len(nodes)-merged > 1 {
+			a, b := take(), take()
+			nodes = append(nodes, node{count: nodes[a].count + nodes[b].count, left: a, right: b})
+		}
+
+		depths := make([]int, len(nodes))
+		longest := 0
+		for n := len(nodes) - 1; n >= 0; n-- {
+			if nodes[n].left < 0 {
+				code.lengths[used[n]] = uint8(depths[n])
+				if depths[n] > longest {
+					longest = depths[n]
+				}
+				continue
+			}
+			depths[nodes[n].left] = depths[n] + 1
+			depths[nodes[n].right] = depths[n] + 1
+		}
+		if longest <= maxLength {
+			break
+		}
+	}
+
+	// Codes are assigned in order of length, then of symbol
+	var counted [maxCodeLength + 1]int
+	for _, length := range code.lengths {
+		counted[length]++
+	}
+	counted[0] = 0
+	var next [maxCodeLength + 1]int
+	for length := 1; length <= maxCodeLength; length++ {
+		next[length] = (next[length-1] + counted[length-1]) << 1
+	}
+	for symbol, length := range code.lengths {
+		if length == 0 {
+			continue
+		}
+		c := next[length]
+		next[length]++
+		reversed := 0
+		for i := 0; i < int(length); i++ {
+			reversed = reversed<<1 | c>>i&1
+		}
+		code.codes[symbol] = uint16(reversed)
+	}
+	return code
+}
+
+// put writes the code of symbol
+func (c *prefixCode) put(w *bitWriter, symbol int) {
+	if !c.single {
+		w.write(uint32(c.codes[symbol]), uint(c.lengths[symbol]))
+	}
+}
+
+// writePrefixCode writes the code lengths of code, section 6.2.1, using the short form
+// for codes of at most two symbols below 256
+func writePrefixCode(w *bitWriter, code prefixCode) {
+	var used []int
+	for symbol, length := range code.lengths {
+		if length > 0 {
+			used = append(used, symbol)
+		}
+	}
+	if len(used) == 0 {
+		used = []int{0}
+	}
+	if len(used) <= 2 && used[len(used)-1] < 256 {
+		w.write(1, 1)
+		w.write(uint32(len(used)-1), 1)
+		if used[0] < 2 {
+			w.write(0, 1)
+			w.write(uint32(used[0]), 1)
+		} else {
+			w.write(1, 1)
+			w.write(uint32(used[0]), 8)
+		}
+		if len(used) == 2 {
+			w.write(uint32(used[1]), 8)
+		}
+		return
+	}
+
+	// The lengths are written with a code of their own, runs of zeros shortened with
+	// the symbols 17 and 18
+	type token struct{ symbol, extra, extraBits int }
+	var tokens []token
+	lengths := code.lengths
+	for i := 0; i < len(lengths); {
+		if lengths[i] != 0 {
+			tokens = append(tokens, token{symbol: int(lengths[i])})
+			i++
+			continue
+		}
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == 0 && run < 138 {
+			run++
+		}
+		switch {
+		case run >= 11:
+			tokens = append(tokens, token{18, run - 11, 7})
+		case run >= 3:
+			tokens = append(tokens, token{17, run - 3, 3})
+		default:
+			run = 1
+			tokens = append(tokens, token{symbol: 0})
+		}
+		i += run
+	}
+
+	counts := make([]uint32, alphabetLengths)
+	for _, t := range tokens {
+		counts[t.symbol]++
+	}
+	lengthCode := newPrefixCode(counts, maxLengthCodeLength)
+	written := 4
+	for i, symbol := range codeLengthOrder {
+		if lengthCode.lengths[symbol] > 0 && i+1 > written {
+			written = i + 1
+		}
+	}
+
+	w.write(0, 1)
+	w.write(uint32(written-4), 4)
+	for _, symbol := range codeLengthOrder[:written] {
+		w.write(uint32(lengthCode.lengths[symbol]), 3)
+	}
+	w.write(0, 1) // lengths for the whole alphabet follow
+	for _, t := range tokens {
+		lengthCode.put(w, t.symbol)
+		w.write(uint32(t.extra), uint(t.extraBits))
+	}
+}
+
+// prefixValue splits a copy length or distance into its symbol and extra bits, section 4.2.2
+func prefixValue(v int) (symbol, extra, extraBits int) {
+	v--
+	if v < 4 {
+		return v, 0, 0
+	}
+	high := 0
+	for v>>(high+1) != 0 {
+		high++
+	}
+	second := v >> (high - 1) & 1
+	return 2*high + second, v & (1<<(high-1) - 1), high - 1
+}
+
+// alphaFilter applies one of the prediction filters of the ALPH chunk, 0 for none,
+// 1 horizontal, 2 vertical and 3 gradient, and returns the differences to the predictions
+func alphaFilter(alpha []byte, width, height, filter int) []byte {
+	if filter == 0 {
+		return alpha
+	}
+	out := make([]byte, len(alpha))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			var pred int
+			switch {
+			case y == 0 && x == 0:
+				pred = 0
+			case y == 0:
+				pred = int(alpha[i-1])
+			case x == 0:
+				pred = int(alpha[i-width])
+			case filter == 1:
+				pred = int(alpha[i-1])
+			case filter == 2:
+				pred = int(alpha[i-width])
+			default:
+				pred = int(clip255(int32(alpha[i-1]) + int32(alpha[i-width]) - int32(alpha[i-width-1])))
+			}
+			out[i] = alpha[i] - byte(pred)
+		}
+	}
+	return out
+}
+
+// encodeAlpha compresses alpha values into the content of an ALPH chunk, trying each
+// filter and keeping the smallest result
+func encodeAlpha(alpha []byte, width, height int) []byte {
+	var best []byte
+	for filter := 0; filter < 4; filter++ {
+		data := encodeAlphaPixels(alphaFilter(alpha, width, height, filter), width)
+		if best == nil || len(data)+1 < len(best) {
+			best = append([]byte{byte(filter<<2 | 1)}, data...)
+		}
+	}
+	return best
+}
+
+// encodeAlphaPixels writes values as the green channel of a lossless image stream without
+// its header and transforms
+func encodeAlphaPixels(values []byte, width int) []byte {
+	// A copy repeats the pixel on the left or the row above when that covers at least
+	// minCopyLength pixels, otherwise values are written as they are
+	type symbol struct {
+		green    int
+		length   int
+		distance int
+	}
+	var symbols []symbol
+	for i := 0; i < len(values); {
+		best, distance := 0, 0
+		if i > 0 {
+			n := 0
+			for i+n < len(values) && n < maxCopyLength && values[i+n] == values[i-1] {
+				n++
+			}
+			best, distance = n, distanceLeft
+		}
+		if i >= width {
+			n := 0
+			for i+n < len(values) && n < maxCopyLength && values[i+n] == values[i+n-width] {
+				n++
+			}
+			if n > best {
+				best, distance = n, distanceAbove
+			}
+		}
+		if best < minCopyLength {
+			symbols = append(symbols, symbol{green: int(values[i])})
+			i++
+			continue
+		}
+		lengthSymbol, _, _ := prefixValue(best)
+		symbols = append(symbols, symbol{green: 256 + lengthSymbol, length: best, distance: distance})
+		i += best
+	}
+
+	greenCounts := make([]uint32, alphabetGreen)
+	distanceCounts := make([]uint32, alphabetDistance)
+	for _, s := range symbols {
+		greenCounts[s.green]++
+		if s.green >= 256 {
+			distanceCounts[s.distance]++
+		}
+	}
+	green := newPrefixCode(greenCounts, maxCodeLength)
+	distance := newPrefixCode(distanceCounts, maxCodeLength)
+	// Red, blue and alpha are always zero
+	zero := newPrefixCode(make([]uint32, alphabetColor), maxCodeLength)
+
+	w := &bitWriter{}
+	w.write(0, 1) // no transforms
+	w.write(0, 1) // no colour cache
+	w.write(0, 1) // one set of prefix codes for the whole image
+	writePrefixCode(w, green)
+	writePrefixCode(w, zero)
+	writePrefixCode(w, zero)
+	writePrefixCode(w, zero)
+	writePrefixCode(w, distance)
+
+	for _, s := range symbols {
+		green.put(w, s.green)
+		if s.green < 256 {
+			continue
+		}
+		_, extra, extraBits := prefixValue(s.length)
+		w.write(uint32(extra), uint(extraBits))
+		distance.put(w, s.distance)
+	}
+	return w.bytes()
+}
@@ -0,0 +1,155 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// webpQuantizer is the VP8 quantizer index of WebP variants, from 0 (best) to 127. Photos
+// come out about as good as JPEGs of jpegQuality in fewer bytes.
+const webpQuantizer = 20
+
+// webpFilterLevel is the strength of the loop filter that hides block edges, from 0 to 63
+const webpFilterLevel = 10
+
+// maxWebPDimension is the largest width and height a VP8 frame can hold
+const maxWebPDimension = 1<<14 - 1
+
+// EncodeWebP writes img as a lossy WebP. Transparency is kept losslessly in an alpha
+// channel next to the lossy colours, as browsers expect it.
+func EncodeWebP(img image.Image) ([]byte, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 1 || height < 1 || width > maxWebPDimension || height > maxWebPDimension {
+		return nil, fmt.Errorf("imaging: cannot encode a %dx%d image as WebP", width, height)
+	}
+
+	pix := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(pix, pix.Bounds(), img, bounds.Min, draw.Src)
+
+	var alpha []byte
+	if !opaque(img) {
+		alpha = make([]byte, width*height)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				alpha[y*width+x] = pix.Pix[y*pix.Stride+x*4+3]
+			}
+		}
+		fillTransparent(pix)
+	}
+
+	y, u, v := toYUV(pix)
+	frame := encodeVP8(y, u, v, width, height, webpQuantizer, webpFilterLevel)
+
+	var out []byte
+	if alpha == nil {
+		out = riffChunk(nil, "VP8 ", frame)
+	} else {
+		// The extended format announces the alpha channel, which precedes the frame
+		header := make([]byte, 10)
+		header[0] = 0x10
+		putUint24(header[4:], width-1)
+		putUint24(header[7:], height-1)
+		out = riffChunk(nil, "VP8X", header)
+		out = riffChunk(out, "ALPH", encodeAlpha(alpha, width, height))
+		out = riffChunk(out, "VP8 ", frame)
+	}
+
+	file := make([]byte, 12, 12+len(out))
+	copy(file, "RIFF")
+	binary.LittleEndian.PutUint32(file[4:], uint32(4+len(out)))
+	copy(file[8:], "WEBP")
+	return append(file, out...), nil
+}
+
+// riffChunk appends a chunk to dst, padded to an even length
+func riffChunk(dst []byte, fourCC string, data []byte) []byte {
+	dst = append(dst, fourCC...)
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(data)))
+	dst = append(dst, data...)
+	if len(data)%2 == 1 {
+		dst = append(dst, 0)
+	}
+	return dst
+}
+
+func putUint24(b []byte, v int) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
+
+// fillTransparent gives fully transparent pixels the colour of a visible pixel next to
+// them on their row, or of the row above, so the lossy colours do not spend bits on
+// invisible edges or bleed a dark fringe into the visible pixels
+func fillTransparent(img *image.NRGBA) {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	for y := 0; y < height; y++ {
+		row := img.Pix[y*img.Stride : y*img.Stride+width*4]
+		last := -1
+		for x := 0; x < width; x++ {
+			if row[x*4+3] == 0 {
+				continue
+			}
+			for i := last + 1; i < x; i++ {
+				copy(row[i*4:i*4+3], row[x*4:x*4+3])
+			}
+			last = x
+		}
+		switch {
+		case last >= 0:
+			for i := last + 1; i < width; i++ {
+				copy(row[i*4:i*4+3], row[last*4:last*4+3])
+			}
+		case y > 0:
+			copy(row, img.Pix[(y-1)*img.Stride:(y-1)*img.Stride+width*4])
+		}
+	}
+}
+
+// toYUV converts img to the limited range BT.601 colours of VP8 with the chroma at half
+// the resolution, padded to whole macroblocks by repeating the last row and column
+func toYUV(img *image.NRGBA) (y, u, v vp8Plane) {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	mbw, mbh := (width+15)/16, (height+15)/16
+	y = newVP8Plane(16*mbw, 16*mbh)
+	u = newVP8Plane(8*mbw, 8*mbh)
+	v = newVP8Plane(8*mbw, 8*mbh)
+
+	rgb := func(x, yy int) (r, g, b int32) {
+		if x >= width {
+			x = width - 1
+		}
+		if yy >= height {
+			yy = height - 1
+		}
+		p := img.Pix[yy*img.Stride+x*4:]
+		return int32(p[0]), int32(p[1]), int32(p[2])
+	}
+
+	for j := 0; j < 16*mbh; j++ {
+		for i := 0; i < 16*mbw; i++ {
+			r, g, b := rgb(i, j)
+			y.pix[j*y.stride+i] = uint8((16839*r + 33059*g + 6420*b + 16<<16 + 1<<15) >> 16)
+		}
+	}
+	for j := 0; j < 8*mbh; j++ {
+		for i := 0; i < 8*mbw; i++ {
+			var r, g, b int32
+			for k := 0; k < 4; k++ {
+				pr, pg, pb := rgb(2*i+k%2, 2*j+k/2)
+				r, g, b = r+pr, g+pg, b+pb
+			}
+			u.pix[j*u.stride+i] = chroma(-9719*r - 19081*g + 28800*b)
+			v.pix[j*v.stride+i] = chroma(28800*r - 24116*g - 4684*b)
+		}
+	}
+	return y, u, v
+}
+
+// chroma scales a chroma value computed from the sum of four pixels
+func chroma(c int32) uint8 {
+	c = (c + 1<<17 + 128<<18) >> 18
+	return uint8(clip255(c))
+}
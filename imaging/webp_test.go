@@ -0,0 +1,212 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// testPhoto returns a w×h image with smooth gradients, a hard edge and some texture, a
+// rough stand-in for a product photo
+func testPhoto(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r := 40 + 180*x/w
+			g := 60 + 150*y/h
+			b := 128 + int(60*math.Sin(float64(x+y)/7))
+			// On even coordinates, so the edge does not split the 2×2 blocks chroma is
+			// subsampled in, which costs JPEGs as much
+			if x >= w/2&^1 && y >= h/3&^1 {
+				r, g, b = 230, 40, 50
+			}
+			// A small repeating texture keeps the blocks from being flat
+			noise := (x*7 + y*13) % 9
+			img.SetNRGBA(x, y, color.NRGBA{uint8(r + noise), uint8(g + noise), uint8(b), 255})
+		}
+	}
+	return img
+}
+
+// psnr returns the peak signal to noise ratio of the colours of b against a, in dB
+func psnr(a, b image.Image) float64 {
+	var sum float64
+	n := 0
+	bounds := a.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			ca := color.NRGBAModel.Convert(a.At(x, y)).(color.NRGBA)
+			cb := color.NRGBAModel.Convert(b.At(x, y)).(color.NRGBA)
+			for _, d := range []float64{
+				float64(ca.R) - float64(cb.R),
+				float64(ca.G) - float64(cb.G),
+				float64(ca.B) - float64(cb.B),
+			} {
+				sum += d * d
+				n++
+			}
+		}
+	}
+	if sum == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255/(sum/float64(n)))
+}
+
+// toRGB converts a decoded frame to RGB with the limited range BT.601 matrix of VP8, as
+// browsers do. image.YCbCr assumes the full range of JPEG instead.
+func toRGB(img image.Image) *image.NRGBA {
+	var ycc *image.YCbCr
+	var withAlpha *image.NYCbCrA
+	switch img := img.(type) {
+	case *image.YCbCr:
+		ycc = img
+	case *image.NYCbCrA:
+		ycc, withAlpha = &img.YCbCr, img
+	default:
+		panic("unexpected image type")
+	}
+
+	bounds := ycc.Bounds()
+	out := image.NewNRGBA(bounds)
+	clamp := func(v float64) uint8 {
+		return uint8(math.Max(0, math.Min(255, math.Round(v))))
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			yy := 1.164 * (float64(ycc.Y[ycc.YOffset(x, y)]) - 16)
+			cb := float64(ycc.Cb[ycc.COffset(x, y)]) - 128
+			cr := float64(ycc.Cr[ycc.COffset(x, y)]) - 128
+			c := color.NRGBA{clamp(yy + 1.596*cr), clamp(yy - 0.813*cr - 0.391*cb), clamp(yy + 2.018*cb), 255}
+			if withAlpha != nil {
+				c.A = withAlpha.A[withAlpha.AOffset(x, y)]
+			}
+			out.SetNRGBA(x, y, c)
+		}
+	}
+	return out
+}
+
+func decodeWebP(t *testing.T, data []byte) image.Image {
+	t.Helper()
+	config, err := webp.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("DecodeConfig: %v", err)
+	}
+	img, err := webp.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if config.Width != img.Bounds().Dx() || config.Height != img.Bounds().Dy() {
+		t.Errorf("header says %dx%d, frame is %v", config.Width, config.Height, img.Bounds())
+	}
+	return img
+}
+
+func TestEncodeWebPOpaque(t *testing.T) {
+	// Sizes that are not whole macroblocks exercise the padding
+	for _, size := range []image.Point{{1, 1}, {16, 16}, {97, 61}, {320, 240}} {
+		src := testPhoto(size.X, size.Y)
+		data, err := EncodeWebP(src)
+		if err != nil {
+			t.Fatalf("%v: %v", size, err)
+		}
+
+		img := decodeWebP(t, data)
+		if got := img.Bounds().Size(); got != size {
+			t.Errorf("%v: decoded size %v", size, got)
+			continue
+		}
+		if _, ok := img.(*image.NYCbCrA); ok {
+			t.Errorf("%v: opaque image encoded with an alpha channel", size)
+		}
+		if p := psnr(src, toRGB(img)); p < 30 {
+			t.Errorf("%v: PSNR %.1f dB, want at least 30", size, p)
+		}
+	}
+}
+
+func TestEncodeWebPFlatColour(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 48, 32))
+	for i := 0; i < len(src.Pix); i += 4 {
+		copy(src.Pix[i:], []byte{200, 120, 40, 255})
+	}
+	data, err := EncodeWebP(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := psnr(src, toRGB(decodeWebP(t, data))); p < 40 {
+		t.Errorf("PSNR %.1f dB, want at least 40", p)
+	}
+}
+
+func TestEncodeWebPAlpha(t *testing.T) {
+	src := testPhoto(75, 50)
+	for y := 0; y < 50; y++ {
+		for x := 0; x < 75; x++ {
+			i := src.PixOffset(x, y) + 3
+			switch {
+			case x < 10:
+				src.Pix[i] = 0
+			case y > 40:
+				src.Pix[i] = uint8(x * 3)
+			case (x/5+y/5)%2 == 0:
+				src.Pix[i] = 128
+			}
+		}
+	}
+
+	data, err := EncodeWebP(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := decodeWebP(t, data)
+	decoded, ok := img.(*image.NYCbCrA)
+	if !ok {
+		t.Fatalf("decoded %T, want *image.NYCbCrA", img)
+	}
+
+	// Alpha is lossless
+	for y := 0; y < 50; y++ {
+		for x := 0; x < 75; x++ {
+			want := src.Pix[src.PixOffset(x, y)+3]
+			if got := decoded.A[decoded.AOffset(x, y)]; got != want {
+				t.Fatalf("alpha at (%d, %d) = %d, want %d", x, y, got, want)
+			}
+		}
+	}
+
+	// Colours are compared where they can be seen
+	visible := image.Rect(10, 0, 75, 50)
+	if p := psnr(opaqueCopy(src, visible), opaqueCopy(toRGB(decoded), visible)); p < 30 {
+		t.Errorf("PSNR of the visible pixels %.1f dB, want at least 30", p)
+	}
+}
+
+// opaqueCopy returns the colours of the pixels of img in r without their alpha
+func opaqueCopy(img image.Image, r image.Rectangle) *image.NRGBA {
+	out := image.NewNRGBA(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			c.A = 255
+			out.SetNRGBA(x, y, c)
+		}
+	}
+	return out
+}
+
+func TestEncodeWebPRejectsBadSizes(t *testing.T) {
+	for _, r := range []image.Rectangle{
+		image.Rect(0, 0, 0, 10),
+		image.Rect(0, 0, maxWebPDimension+1, 1),
+	} {
+		if _, err := EncodeWebP(image.NewNRGBA(r)); err == nil {
+			t.Errorf("%v: no error", r)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package linkcheck
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Result is the outcome of probing one URL
+type Result struct {
+	URL        string
+	StatusCode int
+	OK         bool
+	Error      string
+	CheckedAt  time.Time
+}
+
+// Checker probes URLs with HEAD, falling back to GET for servers that refuse HEAD.
+// At most Concurrency requests run at once and requests to the same host are
+// spaced at least PerHostInterval apart.
+type Checker struct {
+	Client          *http.Client
+	Concurrency     int
+	PerHostInterval time.Duration
+	UserAgent       string
+
+	mu       sync.Mutex
+	nextSlot map[string]time.Time
+}
+
+// NewChecker returns a Checker with the given limits and a client that times out after timeout
+func NewChecker(concurrency int, perHostInterval, timeout time.Duration) *Checker {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Checker{
+		Client:          &http.Client{Timeout: timeout},
+		Concurrency:     concurrency,
+		PerHostInterval: perHostInterval,
+		UserAgent:       "MinnaStyleHub-LinkChecker/1.0",
+	}
+}
+
+// Check probes every URL and returns the results keyed by URL
+func (c *Checker) Check(ctx context.Context, urls []string) map[string]Result {
+	results := make(map[string]Result, len(urls))
+	var resultsMu sync.Mutex
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < c.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for link := range jobs {
+				result := c.CheckURL(ctx, link)
+				resultsMu.Lock()
+				results[link] = result
+				resultsMu.Unlock()
+			}
+		}()
+	}
+
+	for _, link := range urls {
+		select {
+		case jobs <- link:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// CheckURL probes a single URL, honouring the per-host rate limit
+func (c *Checker) CheckURL(ctx context.Context, link string) Result {
+	result := Result{URL: link}
+
+	parsed, err := url.Parse(link)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		result.Error = "invalid URL"
+		result.CheckedAt = time.Now().UTC()
+		return result
+	}
+
+	status, err := c.probe(ctx, http.MethodHead, link, parsed.Host)
+	if err == nil && headUnsupported(status) {
+		status, err = c.probe(ctx, http.MethodGet, link, parsed.Host)
+	}
+
+	result.CheckedAt = time.Now().UTC()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.StatusCode = status
+	result.OK = status < 400
+	return result
+}
+
+// headUnsupported reports statuses servers commonly send for HEAD while GET would work
+func headUnsupported(status int) bool {
+	switch status {
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented, http.StatusForbidden, http.StatusBadRequest:
+		return true
+	}
+	return false
+}
+
+func (c *Checker) probe(ctx context.Context, method, link, host string) (int, error) {
+	if err := c.waitForHost(ctx, host); err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, link, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", c.UserAgent)
+	if method == http.MethodGet {
+		// Only the status matters, don't download whole images
+		req.Header.Set("Range", "bytes=0-0")
+	}
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	return resp.StatusCode, nil
+}
+
+// waitForHost blocks until the host may receive another request
+func (c *Checker) waitForHost(ctx context.Context, host string) error {
+	if c.PerHostInterval <= 0 {
+		return nil
+	}
+	host = strings.ToLower(host)
+
+	c.mu.Lock()
+	if c.nextSlot == nil {
+		c.nextSlot = make(map[string]time.Time)
+	}
+	now := time.Now()
+	slot := c.nextSlot[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	c.nextSlot[host] = slot.Add(c.PerHostInterval)
+	c.mu.Unlock()
+
+	wait := time.Until(slot)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// FromEnv builds a Checker from LINK_CHECK_CONCURRENCY (default 8), LINK_CHECK_HOST_INTERVAL
+// (default 1s) and LINK_CHECK_TIMEOUT (default 15s), and returns LINK_CHECK_INTERVAL
+// (default 24h) as the time between scheduled runs. An interval of 0 disables the schedule.
+func FromEnv() (*Checker, time.Duration) {
+	concurrency := 8
+	if value, err := strconv.Atoi(os.Getenv("LINK_CHECK_CONCURRENCY")); err == nil && value > 0 {
+		concurrency = value
+	}
+
+	checker := NewChecker(concurrency, envDuration("LINK_CHECK_HOST_INTERVAL", time.Second), envDuration("LINK_CHECK_TIMEOUT", 15*time.Second))
+	return checker, envDuration("LINK_CHECK_INTERVAL", 24*time.Hour)
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %s", name, value, fallback)
+		return fallback
+	}
+	return parsed
+}
@@ -0,0 +1,145 @@
+package linkcheck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/missing", http.NotFound)
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok", http.StatusMovedPermanently)
+	})
+	// Some servers refuse HEAD but answer GET, which must then ask for one byte only
+	mux.HandleFunc("/no-head", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if r.Header.Get("Range") != "bytes=0-0" {
+			t.Errorf("GET without a range: %q", r.Header.Get("Range"))
+		}
+		w.WriteHeader(http.StatusPartialContent)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCheckURL(t *testing.T) {
+	server := newTestServer(t)
+	c := NewChecker(4, 0, 100*time.Millisecond)
+
+	tests := []struct {
+		path   string
+		status int
+		ok     bool
+		err    bool
+	}{
+		{path: "/ok", status: http.StatusOK, ok: true},
+		{path: "/moved", status: http.StatusOK, ok: true},
+		{path: "/no-head", status: http.StatusPartialContent, ok: true},
+		{path: "/missing", status: http.StatusNotFound},
+		{path: "/gone", status: http.StatusGone},
+		{path: "/slow", err: true},
+	}
+	for _, test := range tests {
+		result := c.CheckURL(context.Background(), server.URL+test.path)
+		if result.StatusCode != test.status || result.OK != test.ok || (result.Error != "") != test.err {
+			t.Errorf("%s: status %d, ok %v, error %q; want status %d, ok %v, error %v",
+				test.path, result.StatusCode, result.OK, result.Error, test.status, test.ok, test.err)
+		}
+		if result.CheckedAt.IsZero() {
+			t.Errorf("%s: no check time", test.path)
+		}
+	}
+}
+
+func TestCheckURLRejectsInvalidURLs(t *testing.T) {
+	c := NewChecker(1, 0, time.Second)
+	for _, link := range []string{"", "ftp://example.com/a.jpg", "/relative/path", "http://"} {
+		result := c.CheckURL(context.Background(), link)
+		if result.OK || result.Error != "invalid URL" {
+			t.Errorf("%q: ok %v, error %q; want invalid URL", link, result.OK, result.Error)
+		}
+	}
+}
+
+func TestCheckSendsUserAgent(t *testing.T) {
+	var agents []string
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		agents = append(agents, r.UserAgent())
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	c := NewChecker(1, 0, time.Second)
+	c.CheckURL(context.Background(), server.URL)
+	if len(agents) != 1 || agents[0] != c.UserAgent {
+		t.Errorf("user agents %q, want [%q]", agents, c.UserAgent)
+	}
+}
+
+func TestCheckSpacesRequestsToOneHost(t *testing.T) {
+	var times []time.Time
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	interval := 30 * time.Millisecond
+	c := NewChecker(4, interval, time.Second)
+	urls := []string{server.URL + "/a", server.URL + "/b", server.URL + "/c", server.URL + "/d"}
+	results := c.Check(context.Background(), urls)
+
+	if len(results) != len(urls) {
+		t.Fatalf("%d results for %d URLs", len(results), len(urls))
+	}
+	for _, link := range urls {
+		if !results[link].OK {
+			t.Errorf("%s: %+v", link, results[link])
+		}
+	}
+	if total := times[len(times)-1].Sub(times[0]); total < time.Duration(len(urls)-1)*interval-5*time.Millisecond {
+		t.Errorf("%d requests to one host took %s, want at least %s apart", len(urls), total, interval)
+	}
+}
+
+func TestCheckStopsWhenCancelled(t *testing.T) {
+	server := newTestServer(t)
+	c := NewChecker(1, time.Hour, time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	results := c.Check(ctx, []string{server.URL + "/ok", server.URL + "/missing", server.URL + "/gone"})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Check took %s after cancellation", elapsed)
+	}
+	if !results[server.URL+"/ok"].OK {
+		t.Errorf("first URL: %+v", results[server.URL+"/ok"])
+	}
+	for link, result := range results {
+		if link != server.URL+"/ok" && result.OK {
+			t.Errorf("%s checked after cancellation: %+v", link, result)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package linkcheck
+
+import (
+	"context"
+	"log"
+	"minna-style-hub/database"
+	models "minna-style-hub/model"
+	"sync"
+	"time"
+)
+
+// itemLinks is the set of links found on one item
+type itemLinks struct {
+	id    string
+	links []models.LinkCheck
+}
+
+// running guards against overlapping runs from the scheduler and manual triggers
+var running sync.Mutex
+
+// RunOnce checks the ButtonLink and Images of every item and stores the results on the items.
+// URLs shared by several items are only probed once. It returns the number of links
+// checked and how many of them are broken.
+func RunOnce(ctx context.Context, c *Checker) (checked, broken int, err error) {
+	if !running.TryLock() {
+		return 0, 0, nil
+	}
+	defer running.Unlock()
+
+	var items []itemLinks
+	unique := make(map[string]bool)
+	var urls []string
+
+	fields := []string{"buttonLink", "images"}
+	err = database.StreamItems(ctx, database.ItemFilter{}, fields, func(item models.Item) error {
+		entry := itemLinks{id: item.ID}
+		if item.ButtonLink != "" {
+			entry.links = append(entry.links, models.LinkCheck{URL: item.ButtonLink, Kind: models.LinkKindButton})
+		}
+		for _, image := range item.Images {
+			if image.URL != "" {
+				entry.links = append(entry.links, models.LinkCheck{URL: image.URL, Kind: models.LinkKindImage})
+			}
+		}
+		for _, link := range entry.links {
+			if !unique[link.URL] {
+				unique[link.URL] = true
+				urls = append(urls, link.URL)
+			}
+		}
+		items = append(items, entry)
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	results := c.Check(ctx, urls)
+	if ctx.Err() != nil {
+		return 0, 0, ctx.Err()
+	}
+
+	for _, result := range results {
+		checked++
+		if !result.OK {
+			broken++
+		}
+	}
+
+	for _, entry := range items {
+		for i := range entry.links {
+			result := results[entry.links[i].URL]
+			entry.links[i].StatusCode = result.StatusCode
+			entry.links[i].OK = result.OK
+			entry.links[i].Error = result.Error
+			entry.links[i].CheckedAt = result.CheckedAt
+		}
+		if err := database.SetItemLinkChecks(entry.id, entry.links); err != nil {
+			return checked, broken, err
+		}
+	}
+
+	return checked, broken, nil
+}
+
+// Start runs the link check every interval until ctx is cancelled
+func Start(ctx context.Context, c *Checker, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		checked, broken, err := RunOnce(ctx, c)
+		if err != nil {
+			log.Println("Error checking links:", err)
+		} else if checked > 0 {
+			log.Printf("Checked %d links, %d broken", checked, broken)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package locale
+
+import (
+	models "minna-style-hub/model"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default is the locale of the untranslated Title and Text of an item
+const Default = "en"
+
+// Supported lists the locales content can be translated into
+var Supported = []string{"en", "sv"}
+
+// fallbacks maps languages close enough to a supported locale to be served by it
+var fallbacks = map[string]string{
+	"nb": "sv",
+	"nn": "sv",
+	"no": "sv",
+	"da": "sv",
+}
+
+// Match returns the supported locale for a language tag such as "sv-SE", or "" if none fits
+func Match(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	primary := strings.SplitN(strings.ReplaceAll(tag, "_", "-"), "-", 2)[0]
+	for _, supported := range Supported {
+		if primary == supported {
+			return supported
+		}
+	}
+	return fallbacks[primary]
+}
+
+// FromRequest resolves the locale for a request. An explicit lang query parameter wins,
+// then the Accept-Language header is matched by preference, and Default is used last.
+func FromRequest(r *http.Request) string {
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		if matched := Match(lang); matched != "" {
+			return matched
+		}
+	}
+
+	for _, tag := range parseAcceptLanguage(r.Header.Get("Accept-Language")) {
+		if matched := Match(tag); matched != "" {
+			return matched
+		}
+	}
+	return Default
+}
+
+// parseAcceptLanguage returns the language tags of the header ordered by their q value
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.TrimSpace(fields[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if parsed, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag, q})
+		}
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	result := make([]string, len(tags))
+	for i, t := range tags {
+		result[i] = t.tag
+	}
+	return result
+}
+
+// Localize replaces Title and Text of the item with the translation for loc.
+// A missing translated title or text falls back to the default content, and
+// Locale is set to loc when either of them was replaced.
+func Localize(item *models.Item, loc string) {
+	item.Locale = Default
+	if loc == Default {
+		return
+	}
+
+	translation, ok := item.Translations[loc]
+	if !ok {
+		return
+	}
+	if translation.Title != "" {
+		item.Title = translation.Title
+		item.Locale = loc
+	}
+	if translation.Text != "" {
+		item.Text = translation.Text
+		item.TextHTML = translation.TextHTML
+		item.Locale = loc
+	}
+}
+
+// LocalizeAll applies Localize to every item of the slice
+func LocalizeAll(items []models.Item, loc string) {
+	for i := range items {
+		Localize(&items[i], loc)
+	}
+}
+
+// SetHeaders advertises the resolved locale and that responses vary by language
+func SetHeaders(w http.ResponseWriter, loc string) {
+	w.Header().Set("Content-Language", loc)
+	w.Header().Add("Vary", "Accept-Language")
+}
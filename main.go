@@ -1,10 +1,15 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"minna-style-hub/database"
 	"minna-style-hub/functions"
+	"minna-style-hub/imagegc"
+	"minna-style-hub/linkcheck"
+	"minna-style-hub/stockalert"
+	"minna-style-hub/storage"
 	"net/http"
 	"os"
 	"time"
@@ -135,16 +140,117 @@ func main() {
 	if err := database.ConnectToMongoDB(); err != nil {
 		log.Fatal(err)
 	}
+	if err := database.EnsureIndexes(); err != nil {
+		log.Fatal(err)
+	}
+	if err := storage.Configure(); err != nil {
+		log.Fatal(err)
+	}
+	if err := functions.ConfigureClickHashSalt(); err != nil {
+		log.Fatal(err)
+	}
+	// Without a public address the server still runs, minus emails and uploads
+	baseURL, err := functions.ConfigurePublicBaseURL()
+	if err != nil {
+		log.Printf("%v, emails and image uploads are disabled", err)
+	}
+	if err := database.BackfillSlugs(); err != nil {
+		log.Println("Error generating item slugs:", err)
+	}
+	if err := database.BackfillTextHTML(); err != nil {
+		log.Println("Error rendering item text:", err)
+	}
+	if err := database.BackfillTimestamps(); err != nil {
+		log.Println("Error backfilling item timestamps:", err)
+	}
+	if err := database.BackfillImages(); err != nil {
+		log.Println("Error backfilling item images:", err)
+	}
+
+	// Periodically probe ButtonLinks and image URLs for broken links
+	if checker, interval := linkcheck.FromEnv(); interval > 0 {
+		go linkcheck.Start(context.Background(), checker, interval)
+	}
+
+	// Delete uploaded images nothing refers to anymore
+	if interval, grace := imagegc.FromEnv(); interval > 0 {
+		go imagegc.Start(context.Background(), interval, grace)
+	}
+
+	// Send queued back-in-stock emails
+	switch {
+	case os.Getenv("EMAIL_FROM") == "":
+		log.Println("EMAIL_FROM not set, back-in-stock emails are disabled")
+	case baseURL == "":
+		// Already reported with the PUBLIC_BASE_URL error
+	default:
+		interval, _ := stockalert.FromEnv()
+		go stockalert.Start(context.Background(), interval, baseURL)
+	}
 
 	// Define routes
 	r.HandleFunc("/items", functions.GetAllItems).Methods("GET")
+	r.HandleFunc("/items/featured", functions.GetFeaturedItems).Methods("GET")
 	r.HandleFunc("/item/{id}", functions.GetItem).Methods("GET")
+	r.HandleFunc("/item/{id}/related", functions.GetRelatedItems).Methods("GET")
+	r.HandleFunc("/item/{id}/reviews", functions.GetItemReviews).Methods("GET")
+	r.HandleFunc("/item/{id}/reviews", functions.AddReview).Methods("POST")
+	r.HandleFunc("/item/{id}/price-history", functions.GetPriceHistory).Methods("GET")
+	r.HandleFunc("/item/{id}/price-alerts", functions.AddPriceAlert).Methods("POST")
+	r.HandleFunc("/price-alerts/{token}/confirm", functions.ConfirmPriceAlert).Methods("GET", "POST")
+	r.HandleFunc("/price-alerts/{token}/unsubscribe", functions.UnsubscribePriceAlert).Methods("GET", "POST")
+	r.HandleFunc("/price-alerts/{token}", functions.UpdatePriceAlert).Methods("PUT")
+	r.HandleFunc("/item/{id}/stock-alerts", functions.AddStockAlert).Methods("POST")
+	r.HandleFunc("/stock-alerts/{token}/confirm", functions.ConfirmStockAlert).Methods("GET", "POST")
+	r.HandleFunc("/stock-alerts/{token}/unsubscribe", functions.UnsubscribeStockAlert).Methods("GET", "POST")
 	// Add new route for searching items
 	r.HandleFunc("/search", functions.SearchItemsHandler).Methods("GET")
+	r.HandleFunc("/collections", functions.GetCollections).Methods("GET")
+	r.HandleFunc("/attribute-schemas", functions.GetAttributeSchemas).Methods("GET")
+	r.HandleFunc("/collections/{slug}", functions.GetCollection).Methods("GET")
+	r.HandleFunc("/wishlists/shared/{token}", functions.GetSharedWishlist).Methods("GET")
+	r.HandleFunc("/wishlists", functions.GetWishlists).Methods("GET")
+	r.HandleFunc("/wishlists", functions.AddWishlist).Methods("POST")
+	r.HandleFunc("/wishlists/{id}", functions.RenameWishlist).Methods("PUT")
+	r.HandleFunc("/wishlists/{id}", functions.DeleteWishlist).Methods("DELETE")
+	r.HandleFunc("/wishlists/{id}/items", functions.AddWishlistItem).Methods("POST")
+	r.HandleFunc("/wishlists/{id}/items/{itemId}", functions.RemoveWishlistItem).Methods("DELETE")
+	r.HandleFunc("/wishlists/{id}/share", functions.ShareWishlist).Methods("POST")
+	r.HandleFunc("/wishlists/{id}/share", functions.UnshareWishlist).Methods("DELETE")
+	r.HandleFunc("/go/{itemId}", functions.TrackClick).Methods("GET")
+	r.HandleFunc("/assets/{id}", functions.ServeAsset).Methods("GET")
+	r.HandleFunc("/assets/{id}/{width:[0-9]+}", functions.ServeAssetVariant).Methods("GET")
+	r.HandleFunc("/assets/{id}/{width:[0-9]+}.{format:webp}", functions.ServeAssetVariant).Methods("GET")
 	r.HandleFunc("/feedback", functions.GetFeedback).Methods("POST")
 	r.HandleFunc("/login", LoginHandler).Methods("POST")
+	r.Handle("/admin/items", AuthMiddleware(http.HandlerFunc(functions.GetAdminItems))).Methods("GET")
+	r.Handle("/admin/items/{id}", AuthMiddleware(http.HandlerFunc(functions.GetAdminItem))).Methods("GET")
+	r.Handle("/items/export", AuthMiddleware(http.HandlerFunc(functions.ExportItems))).Methods("GET")
+	r.Handle("/items/bulk", AuthMiddleware(http.HandlerFunc(functions.BulkItems))).Methods("POST")
+	r.Handle("/items/featured", AuthMiddleware(http.HandlerFunc(functions.SetFeaturedItems))).Methods("PUT")
+	r.Handle("/uploads", AuthMiddleware(http.HandlerFunc(functions.UploadImages))).Methods("POST")
+	r.Handle("/uploads/presign", AuthMiddleware(http.HandlerFunc(functions.PresignUpload))).Methods("POST")
+	r.Handle("/uploads/{id}/complete", AuthMiddleware(http.HandlerFunc(functions.CompleteUpload))).Methods("POST")
 	r.Handle("/items/add", AuthMiddleware(http.HandlerFunc(functions.AddItem))).Methods("POST")
+	r.Handle("/item/{id}/clone", AuthMiddleware(http.HandlerFunc(functions.CloneItem))).Methods("POST")
 	r.Handle("/items/update", AuthMiddleware(http.HandlerFunc(functions.UpdateItem))).Methods("PUT")
+	r.Handle("/items/{id}/related", AuthMiddleware(http.HandlerFunc(functions.SetRelatedPins))).Methods("PUT")
+	r.Handle("/items/{id}/slug", AuthMiddleware(http.HandlerFunc(functions.SetItemSlug))).Methods("PUT")
+	r.Handle("/admin/collections", AuthMiddleware(http.HandlerFunc(functions.GetAllCollections))).Methods("GET")
+	r.Handle("/collections/add", AuthMiddleware(http.HandlerFunc(functions.AddCollection))).Methods("POST")
+	r.Handle("/collections/update", AuthMiddleware(http.HandlerFunc(functions.UpdateCollection))).Methods("PUT")
+	r.Handle("/collections/{id}", AuthMiddleware(http.HandlerFunc(functions.DeleteCollection))).Methods("DELETE")
+	r.Handle("/attribute-schemas/add", AuthMiddleware(http.HandlerFunc(functions.AddAttributeSchema))).Methods("POST")
+	r.Handle("/attribute-schemas/update", AuthMiddleware(http.HandlerFunc(functions.UpdateAttributeSchema))).Methods("PUT")
+	r.Handle("/attribute-schemas/{id}", AuthMiddleware(http.HandlerFunc(functions.DeleteAttributeSchema))).Methods("DELETE")
+	r.Handle("/admin/reviews", AuthMiddleware(http.HandlerFunc(functions.GetReviewQueue))).Methods("GET")
+	r.Handle("/admin/reviews/{id}", AuthMiddleware(http.HandlerFunc(functions.ModerateReview))).Methods("PUT")
+	r.Handle("/admin/reviews/{id}", AuthMiddleware(http.HandlerFunc(functions.DeleteReview))).Methods("DELETE")
+	r.Handle("/admin/clicks", AuthMiddleware(http.HandlerFunc(functions.GetClickStats))).Methods("GET")
+	r.Handle("/admin/links/broken", AuthMiddleware(http.HandlerFunc(functions.GetBrokenLinks))).Methods("GET")
+	r.Handle("/admin/links/check", AuthMiddleware(http.HandlerFunc(functions.CheckLinks))).Methods("POST")
+	r.Handle("/admin/images/orphans", AuthMiddleware(http.HandlerFunc(functions.GetOrphanedImages))).Methods("GET")
+	r.Handle("/admin/images/orphans/sweep", AuthMiddleware(http.HandlerFunc(functions.SweepOrphanedImages))).Methods("POST")
 	r.Handle("/items/{id}", AuthMiddleware(http.HandlerFunc(functions.DeleteItem))).Methods("DELETE")
 
 	port := os.Getenv("PORT")
@@ -155,7 +261,7 @@ func main() {
 
 	// Apply CORS middleware to your router
 	corsHandler := handlers.CORS(
-		handlers.AllowedHeaders([]string{"Content-Type", "Authorization"}),
+		handlers.AllowedHeaders([]string{"Content-Type", "Authorization", "X-Device-ID"}),
 		handlers.AllowedOrigins([]string{"*"}), // Allow requests from any origin
 		handlers.AllowCredentials(),
 		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE"}), // Allow all methods
@@ -0,0 +1,63 @@
+package markdown
+
+import (
+	"bytes"
+	models "minna-style-hub/model"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// renderer converts Markdown to HTML. Raw HTML in the source is not passed
+// through (goldmark's default), the policy below is a second line of defence.
+var renderer = goldmark.New(
+	goldmark.WithExtensions(
+		extension.Strikethrough,
+		extension.Table,
+		extension.Linkify,
+	),
+)
+
+// policy is the allowlist of elements and attributes that may reach the frontend
+var policy = newPolicy()
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.RequireParseableURLs(true)
+	p.RequireNoFollowOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+	return p
+}
+
+// ToHTML renders Markdown source into sanitized HTML
+func ToHTML(source string) (string, error) {
+	if source == "" {
+		return "", nil
+	}
+
+	var buf bytes.Buffer
+	if err := renderer.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+	return policy.Sanitize(buf.String()), nil
+}
+
+// RenderItem fills TextHTML of the item and of each translation from their Markdown text
+func RenderItem(item *models.Item) error {
+	html, err := ToHTML(item.Text)
+	if err != nil {
+		return err
+	}
+	item.TextHTML = html
+
+	for loc, translation := range item.Translations {
+		translation.TextHTML, err = ToHTML(translation.Text)
+		if err != nil {
+			return err
+		}
+		item.Translations[loc] = translation
+	}
+	return nil
+}
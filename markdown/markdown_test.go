@@ -0,0 +1,163 @@
+package markdown
+
+import (
+	models "minna-style-hub/model"
+	"strings"
+	"testing"
+)
+
+// render is ToHTML for sources that must render without error
+func render(t *testing.T, source string) string {
+	t.Helper()
+	html, err := ToHTML(source)
+	if err != nil {
+		t.Fatalf("ToHTML(%q): %v", source, err)
+	}
+	return html
+}
+
+func TestToHTMLFormatting(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"", ""},
+		{"**bold** and _italic_", "<p><strong>bold</strong> and <em>italic</em></p>\n"},
+		{"~~gone~~", "<p><del>gone</del></p>\n"},
+		{"- one\n- two", "<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n"},
+		{"## Care", "<h2>Care</h2>\n"},
+		{"a < b & c", "<p>a &lt; b &amp; c</p>\n"},
+	}
+	for _, test := range tests {
+		if got := render(t, test.source); got != test.want {
+			t.Errorf("ToHTML(%q) = %q, want %q", test.source, got, test.want)
+		}
+	}
+
+	table := render(t, "| Size | Chest |\n|---|---|\n| S | 90 |")
+	for _, tag := range []string{"<table>", "<th>Size</th>", "<td>90</td>"} {
+		if !strings.Contains(table, tag) {
+			t.Errorf("table %q has no %s", table, tag)
+		}
+	}
+}
+
+func TestToHTMLStripsScripts(t *testing.T) {
+	for _, source := range []string{
+		"<script>alert(1)</script>",
+		"before\n\n<script>alert(1)</script>\n\nafter",
+		"inline <script>alert(1)</script> text",
+		"<div><script src=\"https://evil.example/x.js\"></script></div>",
+		"<iframe src=\"https://evil.example\"></iframe>",
+		"<style>body{display:none}</style>",
+	} {
+		html := render(t, source)
+		for _, tag := range []string{"<script", "<iframe", "<style"} {
+			if strings.Contains(strings.ToLower(html), tag) {
+				t.Errorf("ToHTML(%q) = %q keeps %s", source, html, tag)
+			}
+		}
+	}
+}
+
+func TestToHTMLStripsUnsafeLinks(t *testing.T) {
+	for _, source := range []string{
+		"[click](javascript:alert(1))",
+		"[click](JavaScript:alert(1))",
+		"[click](vbscript:msgbox(1))",
+		"[click](data:text/html;base64,PHNjcmlwdD4=)",
+		"![img](javascript:alert(1))",
+		"<a href=\"javascript:alert(1)\">click</a>",
+		"<javascript:alert(1)>",
+	} {
+		html := render(t, source)
+		lower := strings.ToLower(html)
+		for _, scheme := range []string{"javascript:", "vbscript:", "data:"} {
+			if strings.Contains(lower, "href=\""+scheme) || strings.Contains(lower, "src=\""+scheme) {
+				t.Errorf("ToHTML(%q) = %q links to %s", source, html, scheme)
+			}
+		}
+	}
+
+	if html := render(t, "[mail](mailto:shop@example.com)"); !strings.Contains(html, `href="mailto:shop@example.com"`) {
+		t.Errorf("mailto link dropped: %q", html)
+	}
+}
+
+func TestToHTMLStripsEventAttributes(t *testing.T) {
+	for _, source := range []string{
+		"<img src=\"https://example.com/a.jpg\" onerror=\"alert(1)\">",
+		"<a href=\"https://example.com\" onclick=\"alert(1)\">x</a>",
+		"<p onmouseover=\"alert(1)\">x</p>",
+		"<b style=\"background:url(javascript:alert(1))\">x</b>",
+	} {
+		html := render(t, source)
+		lower := strings.ToLower(html)
+		for _, attr := range []string{"onerror", "onclick", "onmouseover", "style="} {
+			if strings.Contains(lower, attr) {
+				t.Errorf("ToHTML(%q) = %q keeps %s", source, html, attr)
+			}
+		}
+	}
+}
+
+// The renderer already drops raw HTML, so the policy is also checked on its own
+func TestPolicySanitizesRawHTML(t *testing.T) {
+	tests := []struct {
+		html string
+		want string
+	}{
+		{`<p>ok<script>alert(1)</script></p>`, `<p>ok</p>`},
+		{`<a href="javascript:alert(1)">x</a>`, `x`},
+		{`<img src="https://example.com/a.jpg" onerror="alert(1)">`, `<img src="https://example.com/a.jpg">`},
+		{`<p onclick="alert(1)">x</p>`, `<p>x</p>`},
+		{`<a href="/local">x</a>`, `<a href="/local" rel="nofollow">x</a>`},
+	}
+	for _, test := range tests {
+		if got := policy.Sanitize(test.html); got != test.want {
+			t.Errorf("Sanitize(%q) = %q, want %q", test.html, got, test.want)
+		}
+	}
+}
+
+func TestToHTMLLinksAreNofollow(t *testing.T) {
+	for _, source := range []string{
+		"[shop](https://shop.example.com/dress)",
+		"see https://shop.example.com/dress",
+		"<https://shop.example.com/dress>",
+	} {
+		html := render(t, source)
+		if !strings.Contains(html, `href="https://shop.example.com/dress"`) {
+			t.Errorf("ToHTML(%q) = %q has no link", source, html)
+			continue
+		}
+		if !strings.Contains(html, `rel="nofollow noopener"`) {
+			t.Errorf("ToHTML(%q) = %q is not nofollow", source, html)
+		}
+		if !strings.Contains(html, `target="_blank"`) {
+			t.Errorf("ToHTML(%q) = %q does not open in a new tab", source, html)
+		}
+	}
+}
+
+func TestRenderItem(t *testing.T) {
+	item := models.Item{
+		Text: "**hello**",
+		Translations: map[string]models.ItemTranslation{
+			"sv": {Text: "*hej*"},
+			"en": {},
+		},
+	}
+	if err := RenderItem(&item); err != nil {
+		t.Fatal(err)
+	}
+	if item.TextHTML != "<p><strong>hello</strong></p>\n" {
+		t.Errorf("TextHTML = %q", item.TextHTML)
+	}
+	if got := item.Translations["sv"].TextHTML; got != "<p><em>hej</em></p>\n" {
+		t.Errorf("sv TextHTML = %q", got)
+	}
+	if got := item.Translations["en"].TextHTML; got != "" {
+		t.Errorf("empty translation rendered to %q", got)
+	}
+}
@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// Asset is an uploaded file kept in blob storage. Items refer to uploaded images by
+// sending "asset:<id>" as the URL of an Image, which is stored as the URL the asset is served at.
+type Asset struct {
+	ID          string    `json:"_id" bson:"_id"`
+	Key         string    `json:"-" bson:"key"`
+	Filename    string    `json:"filename" bson:"filename"`
+	ContentType string    `json:"contentType" bson:"contentType"`
+	Size        int64     `json:"size" bson:"size"`
+	Width       int       `json:"width,omitempty" bson:"width,omitempty"`
+	Height      int       `json:"height,omitempty" bson:"height,omitempty"`
+	CreatedAt   time.Time `json:"createdAt" bson:"createdAt"`
+	// DominantColor and Blurhash are placeholders computed from uploaded images, see Image
+	DominantColor string `json:"dominantColor,omitempty" bson:"dominantColor,omitempty"`
+	Blurhash      string `json:"blurhash,omitempty" bson:"blurhash,omitempty"`
+	// Variants are resized renditions of an uploaded image, smallest first
+	Variants []AssetVariant `json:"variants,omitempty" bson:"variants,omitempty"`
+	// UnreferencedAt is when the image collector first found nothing referring to the
+	// asset; it is cleared once something does again
+	UnreferencedAt *time.Time `json:"unreferencedAt,omitempty" bson:"unreferencedAt,omitempty"`
+	// URL is where the asset is served, it is filled in for responses and never stored
+	URL string `json:"url,omitempty" bson:"-"`
+}
+
+// AssetVariant is a resized rendition of an uploaded image
+type AssetVariant struct {
+	Width       int    `json:"width" bson:"width"`
+	Height      int    `json:"height" bson:"height"`
+	ContentType string `json:"contentType" bson:"contentType"`
+	Key         string `json:"-" bson:"key"`
+}
+
+// ImageSet describes the renditions of one item image for responsive markup. Srcset
+// is ready for an <img srcset> attribute; it is empty for images hosted elsewhere.
+// Sources also has the WebP renditions, listed first for the <source> elements of a <picture>.
+type ImageSet struct {
+	URL     string        `json:"url"`
+	Width   int           `json:"width,omitempty"`
+	Height  int           `json:"height,omitempty"`
+	Srcset  string        `json:"srcset,omitempty"`
+	Sources []ImageSource `json:"sources,omitempty"`
+}
+
+// ImageSource is one rendition listed in an ImageSet
+type ImageSource struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Type   string `json:"type"`
+}
+
+// PendingUpload is an upload a client sends straight to blob storage through a presigned
+// URL. It becomes an Asset with the same id once the upload is completed and checked.
+type PendingUpload struct {
+	ID          string    `json:"_id" bson:"_id"`
+	Key         string    `json:"-" bson:"key"`
+	Filename    string    `json:"filename" bson:"filename"`
+	ContentType string    `json:"contentType" bson:"contentType"`
+	Size        int64     `json:"size" bson:"size"`
+	CreatedAt   time.Time `json:"createdAt" bson:"createdAt"`
+	ExpiresAt   time.Time `json:"expiresAt" bson:"expiresAt"`
+}
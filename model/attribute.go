@@ -0,0 +1,36 @@
+package models
+
+import "regexp"
+
+// Attribute types
+const (
+	AttributeString  = "string"
+	AttributeNumber  = "number"
+	AttributeBoolean = "boolean"
+	AttributeEnum    = "enum"
+)
+
+// attributeNamePattern keeps attribute names usable as MongoDB field names and query parameters
+var attributeNamePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{0,49}$`)
+
+// AttributeSchema defines the custom attributes that items of a category may carry
+type AttributeSchema struct {
+	ID         string                `json:"_id,omitempty" bson:"_id,omitempty"`
+	Category   string                `json:"category" bson:"category" validate:"required,max=100"`
+	Attributes []AttributeDefinition `json:"attributes" bson:"attributes" validate:"max=50,dive"`
+}
+
+// AttributeDefinition describes one custom attribute. Values lists the allowed values of
+// enum attributes and optionally restricts string attributes.
+type AttributeDefinition struct {
+	Name     string   `json:"name" bson:"name" validate:"required,max=50"`
+	Label    string   `json:"label,omitempty" bson:"label,omitempty" validate:"max=100"`
+	Type     string   `json:"type" bson:"type" validate:"required,oneof=string|number|boolean|enum"`
+	Values   []string `json:"values,omitempty" bson:"values,omitempty" validate:"max=100,dive,required,max=100"`
+	Required bool     `json:"required,omitempty" bson:"required,omitempty"`
+}
+
+// ValidAttributeName reports whether name may be used as an attribute name
+func ValidAttributeName(name string) bool {
+	return attributeNamePattern.MatchString(name)
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Click records one visitor following the ButtonLink of an item
+type Click struct {
+	ID        string    `json:"_id,omitempty" bson:"_id,omitempty"`
+	ItemID    string    `json:"itemId" bson:"itemId"`
+	Brand     string    `json:"brand" bson:"brand"`
+	Timestamp time.Time `json:"timestamp" bson:"timestamp"`
+	Referrer  string    `json:"referrer,omitempty" bson:"referrer,omitempty"`
+	IPHash    string    `json:"ipHash,omitempty" bson:"ipHash,omitempty"`
+	UserAgent string    `json:"userAgent,omitempty" bson:"userAgent,omitempty"`
+}
+
+// ClickCount is the number of clicks for one item, brand or day
+type ClickCount struct {
+	Key   string `json:"key" bson:"_id"`
+	Title string `json:"title,omitempty" bson:"title,omitempty"`
+	Count int    `json:"count" bson:"count"`
+}
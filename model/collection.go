@@ -0,0 +1,14 @@
+package models
+
+// Collection is a curated, ordered group of items such as a themed edit or lookbook
+type Collection struct {
+	ID          string   `json:"_id,omitempty" bson:"_id,omitempty"`
+	Title       string   `json:"title" bson:"title" validate:"required,max=200"`
+	Slug        string   `json:"slug,omitempty" bson:"slug,omitempty" validate:"max=80"`
+	Description string   `json:"description" bson:"description" validate:"max=5000"`
+	CoverImage  string   `json:"coverImage,omitempty" bson:"coverImage,omitempty" validate:"image"`
+	ItemIDs     []string `json:"itemIds" bson:"itemIds" validate:"max=200,dive,required"`
+	Status      string   `json:"status,omitempty" bson:"status,omitempty" validate:"oneof=draft|published|archived"`
+	// Items holds the referenced items in order when a collection is returned publicly
+	Items []Item `json:"items,omitempty" bson:"-"`
+}
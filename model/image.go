@@ -0,0 +1,85 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// Image is one picture of an item, the first is the main picture. Width, Height,
+// DominantColor and Blurhash are derived from uploaded images by the server and stay
+// empty for images hosted elsewhere.
+//
+// Images used to be plain URL strings. A string is still accepted in JSON and read from
+// BSON as an Image with only URL set.
+type Image struct {
+	URL string `json:"url" bson:"url" validate:"required,image,max=2048"`
+	// Alt is the text alternative per locale for screen readers and broken images
+	Alt    map[string]string `json:"alt,omitempty" bson:"alt,omitempty" validate:"locales,dive,max=300"`
+	Width  int               `json:"width,omitempty" bson:"width,omitempty"`
+	Height int               `json:"height,omitempty" bson:"height,omitempty"`
+	// FocalPoint is the part of the image that should stay visible when it is cropped
+	FocalPoint *FocalPoint `json:"focalPoint,omitempty" bson:"focalPoint,omitempty" validate:"dive"`
+	// DominantColor is a "#rrggbb" colour to show while the image loads
+	DominantColor string `json:"dominantColor,omitempty" bson:"dominantColor,omitempty"`
+	// Blurhash is a compact placeholder, see https://blurha.sh
+	Blurhash string `json:"blurhash,omitempty" bson:"blurhash,omitempty"`
+}
+
+// FocalPoint is a position within an image, X from the left and Y from the top edge,
+// both as a fraction of the size between 0 and 1
+type FocalPoint struct {
+	X float64 `json:"x" bson:"x" validate:"min=0,max=1"`
+	Y float64 `json:"y" bson:"y" validate:"min=0,max=1"`
+}
+
+// image has the fields of Image without its decoding methods
+type image Image
+
+// UnmarshalJSON accepts an image object or a plain URL string
+func (img *Image) UnmarshalJSON(data []byte) error {
+	var url string
+	if err := json.Unmarshal(data, &url); err == nil {
+		*img = Image{URL: url}
+		return nil
+	}
+	var decoded image
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*img = Image(decoded)
+	return nil
+}
+
+// UnmarshalBSONValue reads images stored as documents and the URL strings stored before them
+func (img *Image) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	switch t {
+	case bsontype.String:
+		url, _, ok := bsoncore.ReadString(data)
+		if !ok {
+			return fmt.Errorf("invalid image URL")
+		}
+		*img = Image{URL: url}
+		return nil
+	case bsontype.EmbeddedDocument:
+		var decoded image
+		if err := bson.Unmarshal(data, &decoded); err != nil {
+			return err
+		}
+		*img = Image(decoded)
+		return nil
+	}
+	return fmt.Errorf("cannot decode %s into an image", t)
+}
+
+// ImageURLs returns the URLs of the images in order
+func ImageURLs(images []Image) []string {
+	urls := make([]string, len(images))
+	for i, img := range images {
+		urls[i] = img.URL
+	}
+	return urls
+}
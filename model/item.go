@@ -1,17 +1,106 @@
 package models
 
+import "time"
+
 // Item represents an item stored in the database
 type Item struct {
 	ID         string   `json:"_id,omitempty" bson:"_id,omitempty"`
-	Title      string   `json:"title"`
-	Text       string   `json:"text"`
-	Brand      string   `json:"brand"`
-	Images     []string `json:"images"`
-	ButtonLink string   `json:"buttonLink"`
+	Title      string   `json:"title" validate:"required,max=200"`
+	Text       string   `json:"text" validate:"max=10000"`
+	Brand      string   `json:"brand" validate:"required,max=100"`
+	Images     []Image  `json:"images" validate:"max=20,dive"`
+	ButtonLink string   `json:"buttonLink" validate:"url,max=2048"`
+	Tags       []string `json:"tags,omitempty" bson:"tags,omitempty" validate:"max=30,dive,required,max=50"`
+	Status     string   `json:"status,omitempty" bson:"status,omitempty" validate:"oneof=draft|published|archived"`
+	Category   string   `json:"category,omitempty" bson:"category,omitempty" validate:"max=100"`
+	Price      float64  `json:"price,omitempty" bson:"price,omitempty" validate:"min=0"`
+	// OutOfStock is set while the item cannot be bought; visitors may subscribe to its return
+	OutOfStock bool `json:"outOfStock,omitempty" bson:"outOfStock,omitempty"`
+	// Attributes holds the custom attributes defined by the AttributeSchema of the category
+	Attributes map[string]interface{} `json:"attributes,omitempty" bson:"attributes,omitempty" validate:"max=50"`
+	// TextHTML is Text rendered from Markdown and sanitized, it is computed on every write
+	TextHTML string `json:"textHtml,omitempty" bson:"textHtml,omitempty"`
+	// Slug is the URL friendly name of the item; previous slugs are kept in SlugHistory
+	// so old links can be redirected. SlugManual is set when an admin chose the slug.
+	Slug        string   `json:"slug,omitempty" bson:"slug,omitempty" validate:"max=80"`
+	SlugHistory []string `json:"slugHistory,omitempty" bson:"slugHistory,omitempty"`
+	SlugManual  bool     `json:"slugManual,omitempty" bson:"slugManual,omitempty"`
+	// Translations holds the title and text per locale; Title and Text are the default locale
+	Translations map[string]ItemTranslation `json:"translations,omitempty" bson:"translations,omitempty" validate:"locales,dive"`
+	// Rating is the average of the approved reviews, ReviewCount how many there are
+	Rating      float64 `json:"rating,omitempty" bson:"rating,omitempty"`
+	ReviewCount int     `json:"reviewCount" bson:"reviewCount,omitempty"`
+	// RelatedPins are item ids an admin placed first in the related items of this item
+	RelatedPins []string `json:"relatedPins,omitempty" bson:"relatedPins,omitempty"`
+	// ClonedFrom is the id of the item this item was cloned from
+	ClonedFrom string `json:"clonedFrom,omitempty" bson:"clonedFrom,omitempty"`
+	// LinkChecks holds the result of the last broken link check of ButtonLink and Images
+	LinkChecks []LinkCheck `json:"linkChecks,omitempty" bson:"linkChecks,omitempty"`
+	// Featured marks items in the homepage ordering and FeaturedPosition is their 1-based
+	// place in it. Both are filled in from the ordering when items are listed, never stored.
+	Featured         bool `json:"featured,omitempty" bson:"-"`
+	FeaturedPosition int  `json:"featuredPosition,omitempty" bson:"-"`
+	// CreatedAt and UpdatedAt are maintained by the database package
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt,omitempty"`
+	// ImageSets lists the responsive renditions of Images, in the same order. It is
+	// filled in for responses and never stored.
+	ImageSets []ImageSet `json:"imageSets,omitempty" bson:"-"`
+	// Score is the text search relevance of a search result, it is never stored
+	Score float64 `json:"score,omitempty" bson:"-"`
+	// Locale is the locale the Title and Text of a response are in, it is never stored.
+	// Items sent back with another locale than the default one are rejected.
+	Locale string `json:"locale,omitempty" bson:"-"`
+}
+
+// ItemTranslation holds the localised content of an item for one locale
+type ItemTranslation struct {
+	Title string `json:"title" bson:"title" validate:"max=200"`
+	Text  string `json:"text" bson:"text" validate:"max=10000"`
+	// TextHTML is Text rendered from Markdown and sanitized
+	TextHTML string `json:"textHtml,omitempty" bson:"textHtml,omitempty"`
+}
+
+// Item publishing statuses
+const (
+	StatusDraft     = "draft"
+	StatusPublished = "published"
+	StatusArchived  = "archived"
+)
+
+// IsPublished reports whether visitors may see the item. Items saved before statuses
+// existed have none and count as published.
+func (item Item) IsPublished() bool {
+	return item.Status == "" || item.Status == StatusPublished
+}
+
+// ValidStatus reports whether status is one of the known item statuses
+func ValidStatus(status string) bool {
+	switch status {
+	case StatusDraft, StatusPublished, StatusArchived:
+		return true
+	}
+	return false
 }
 
 type Feedback struct {
-	Name    string `json:"name"`
-	Email   string `json:"email"`
-	Message string `json:"message"`
+	Name    string `json:"name" validate:"required,max=100"`
+	Email   string `json:"email" validate:"required,email,max=254"`
+	Message string `json:"message" validate:"required,max=5000"`
 }
+
+// LinkCheck is the last known state of one outbound or image URL of an item
+type LinkCheck struct {
+	URL        string    `json:"url" bson:"url"`
+	Kind       string    `json:"kind" bson:"kind"`
+	StatusCode int       `json:"statusCode,omitempty" bson:"statusCode,omitempty"`
+	OK         bool      `json:"ok" bson:"ok"`
+	Error      string    `json:"error,omitempty" bson:"error,omitempty"`
+	CheckedAt  time.Time `json:"checkedAt" bson:"checkedAt"`
+}
+
+// Kinds of links recorded in LinkCheck
+const (
+	LinkKindButton = "buttonLink"
+	LinkKindImage  = "image"
+)
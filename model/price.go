@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// PriceChange records a change of the price of an item. OldPrice is 0 for the first price.
+type PriceChange struct {
+	ID        string    `json:"_id,omitempty" bson:"_id,omitempty"`
+	ItemID    string    `json:"itemId" bson:"itemId"`
+	OldPrice  float64   `json:"oldPrice" bson:"oldPrice"`
+	Price     float64   `json:"price" bson:"price"`
+	ChangedAt time.Time `json:"changedAt" bson:"changedAt"`
+}
+
+// PriceAlert is a visitor's subscription to a price drop of an item. The visitor is
+// emailed once the price falls below Threshold; the alert is armed again when the
+// price rises back to the threshold or above. Token authorises confirming and unsubscribing;
+// an alert is only armed once the visitor followed the link in the confirmation email.
+type PriceAlert struct {
+	ID          string     `json:"_id,omitempty" bson:"_id,omitempty"`
+	ItemID      string     `json:"itemId" bson:"itemId"`
+	Email       string     `json:"email" bson:"email"`
+	Threshold   float64    `json:"threshold" bson:"threshold"`
+	Token       string     `json:"-" bson:"token"`
+	CreatedAt   time.Time  `json:"createdAt" bson:"createdAt"`
+	NotifiedAt  *time.Time `json:"notifiedAt,omitempty" bson:"notifiedAt,omitempty"`
+	ConfirmedAt *time.Time `json:"confirmedAt,omitempty" bson:"confirmedAt,omitempty"`
+	// ConfirmBy is when an unconfirmed alert is deleted
+	ConfirmBy *time.Time `json:"-" bson:"confirmBy,omitempty"`
+	// ConfirmSentAt is when the last confirmation email was sent
+	ConfirmSentAt *time.Time `json:"-" bson:"confirmSentAt,omitempty"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Review moderation statuses
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+// Review is a customer rating of an item. Only approved reviews are public
+// and count towards the rating stored on the item.
+type Review struct {
+	ID          string     `json:"_id,omitempty" bson:"_id,omitempty"`
+	ItemID      string     `json:"itemId" bson:"itemId"`
+	Rating      int        `json:"rating" bson:"rating"`
+	Title       string     `json:"title" bson:"title"`
+	Body        string     `json:"body" bson:"body"`
+	Author      string     `json:"author" bson:"author"`
+	Status      string     `json:"status" bson:"status"`
+	CreatedAt   time.Time  `json:"createdAt" bson:"createdAt"`
+	ModeratedAt *time.Time `json:"moderatedAt,omitempty" bson:"moderatedAt,omitempty"`
+}
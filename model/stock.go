@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// StockSubscription is a visitor's request to be emailed when an out of stock item is
+// available again. It is deleted once the email is sent or when it expires. Until the
+// visitor follows the link in the confirmation email it is never notified and expires soon.
+type StockSubscription struct {
+	ID          string     `json:"_id,omitempty" bson:"_id,omitempty"`
+	ItemID      string     `json:"itemId" bson:"itemId"`
+	Email       string     `json:"email" bson:"email"`
+	Token       string     `json:"-" bson:"token"`
+	CreatedAt   time.Time  `json:"createdAt" bson:"createdAt"`
+	ExpiresAt   time.Time  `json:"expiresAt" bson:"expiresAt"`
+	ConfirmedAt *time.Time `json:"confirmedAt,omitempty" bson:"confirmedAt,omitempty"`
+	// ConfirmSentAt is when the last confirmation email was sent
+	ConfirmSentAt *time.Time `json:"-" bson:"confirmSentAt,omitempty"`
+	// QueuedAt is set when the item came back in stock and the email waits to be sent
+	QueuedAt  *time.Time `json:"-" bson:"queuedAt,omitempty"`
+	ClaimedAt *time.Time `json:"-" bson:"claimedAt,omitempty"`
+	Attempts  int        `json:"-" bson:"attempts,omitempty"`
+}
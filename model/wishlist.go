@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Wishlist is a named list of items saved by an anonymous device
+type Wishlist struct {
+	ID string `json:"_id,omitempty" bson:"_id,omitempty"`
+	// Owner is "device:<device id>"
+	Owner      string    `json:"-" bson:"owner"`
+	Name       string    `json:"name" bson:"name" validate:"required,max=100"`
+	ItemIDs    []string  `json:"itemIds" bson:"itemIds"`
+	ShareToken string    `json:"shareToken,omitempty" bson:"shareToken,omitempty"`
+	CreatedAt  time.Time `json:"createdAt" bson:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt" bson:"updatedAt"`
+	// Items holds the saved items in order when a wishlist is returned
+	Items []Item `json:"items,omitempty" bson:"-"`
+}
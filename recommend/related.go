@@ -0,0 +1,238 @@
+package recommend
+
+import (
+	"context"
+	"math"
+	"minna-style-hub/database"
+	models "minna-style-hub/model"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// cacheTTL is how long a built index is reused before the catalog is read again
+const cacheTTL = 10 * time.Minute
+
+// Weights of the individual similarity signals, they add up to 1
+const (
+	textWeight     = 0.45
+	brandWeight    = 0.2
+	categoryWeight = 0.2
+	tagWeight      = 0.15
+)
+
+// minScore drops candidates that share next to nothing with the item
+const minScore = 0.05
+
+// stopwords are skipped when building TF-IDF vectors (English and Swedish)
+var stopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true,
+	"by": true, "for": true, "from": true, "in": true, "is": true, "it": true, "of": true,
+	"on": true, "or": true, "the": true, "this": true, "to": true, "with": true,
+	"och": true, "att": true, "det": true, "en": true, "ett": true, "för": true, "i": true,
+	"med": true, "på": true, "som": true, "till": true, "av": true, "är": true, "den": true,
+}
+
+// document is the part of an item the similarity is computed from
+type document struct {
+	item     models.Item
+	vector   map[string]float64
+	tags     map[string]bool
+	brand    string
+	category string
+}
+
+// Index holds the TF-IDF vectors of the catalog
+type Index struct {
+	docs map[string]*document
+}
+
+// Scored is the id of a related item together with its similarity score
+type Scored struct {
+	ID    string
+	Score float64
+}
+
+var (
+	mu      sync.Mutex
+	cached  *Index
+	builtAt time.Time
+)
+
+// Invalidate drops the cached index so the next lookup rebuilds it
+func Invalidate() {
+	mu.Lock()
+	cached = nil
+	mu.Unlock()
+}
+
+// current returns the cached index, rebuilding it from the database when it is missing or stale
+func current(ctx context.Context) (*Index, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if cached != nil && time.Since(builtAt) < cacheTTL {
+		return cached, nil
+	}
+
+	var items []models.Item
+	fields := []string{"title", "text", "brand", "tags", "category", "status"}
+	err := database.StreamItems(ctx, database.ItemFilter{}, fields, func(item models.Item) error {
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cached = Build(items)
+	builtAt = time.Now()
+	return cached, nil
+}
+
+// Related returns up to limit items most similar to the item with the given id,
+// leaving out the ids in exclude
+func Related(ctx context.Context, id string, exclude map[string]bool, limit int) ([]Scored, error) {
+	index, err := current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return index.Related(id, exclude, limit), nil
+}
+
+// Build computes TF-IDF vectors for the items
+func Build(items []models.Item) *Index {
+	index := &Index{docs: make(map[string]*document, len(items))}
+
+	termCounts := make(map[string]map[string]int, len(items))
+	docFreq := make(map[string]int)
+	for _, item := range items {
+		counts := make(map[string]int)
+		// The title is counted twice so it weighs more than the description
+		for _, term := range tokenize(item.Title + " " + item.Title + " " + item.Text) {
+			counts[term]++
+		}
+		for term := range counts {
+			docFreq[term]++
+		}
+		termCounts[item.ID] = counts
+	}
+
+	total := float64(len(items))
+	for _, item := range items {
+		vector := make(map[string]float64)
+		norm := 0.0
+		for term, count := range termCounts[item.ID] {
+			weight := (1 + math.Log(float64(count))) * math.Log(1+total/float64(docFreq[term]))
+			vector[term] = weight
+			norm += weight * weight
+		}
+		if norm > 0 {
+			norm = math.Sqrt(norm)
+			for term := range vector {
+				vector[term] /= norm
+			}
+		}
+
+		tags := make(map[string]bool, len(item.Tags))
+		for _, tag := range item.Tags {
+			tags[strings.ToLower(tag)] = true
+		}
+
+		index.docs[item.ID] = &document{
+			item:     item,
+			vector:   vector,
+			tags:     tags,
+			brand:    strings.ToLower(strings.TrimSpace(item.Brand)),
+			category: strings.ToLower(strings.TrimSpace(item.Category)),
+		}
+	}
+	return index
+}
+
+// Related ranks the other published items by similarity to the item with the given id
+func (index *Index) Related(id string, exclude map[string]bool, limit int) []Scored {
+	source, ok := index.docs[id]
+	if !ok {
+		return nil
+	}
+
+	var scored []Scored
+	for otherID, doc := range index.docs {
+		if otherID == id || exclude[otherID] || !listed(doc.item) {
+			continue
+		}
+		score := similarity(source, doc)
+		if score >= minScore {
+			scored = append(scored, Scored{ID: otherID, Score: score})
+		}
+	}
+
+	sort.Slice(scored, func(i, j int) bool {
+		if scored[i].Score != scored[j].Score {
+			return scored[i].Score > scored[j].Score
+		}
+		return scored[i].ID < scored[j].ID
+	})
+	if len(scored) > limit {
+		scored = scored[:limit]
+	}
+	return scored
+}
+
+// listed reports whether the item may be shown to visitors
+func listed(item models.Item) bool {
+	return item.Status == "" || item.Status == models.StatusPublished
+}
+
+func similarity(a, b *document) float64 {
+	score := textWeight * cosine(a.vector, b.vector)
+	if a.brand != "" && a.brand == b.brand {
+		score += brandWeight
+	}
+	if a.category != "" && a.category == b.category {
+		score += categoryWeight
+	}
+	score += tagWeight * jaccard(a.tags, b.tags)
+	return score
+}
+
+func cosine(a, b map[string]float64) float64 {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+	dot := 0.0
+	for term, weight := range a {
+		dot += weight * b[term]
+	}
+	return dot
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for tag := range a {
+		if b[tag] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// tokenize lowercases text and splits it into words, dropping stopwords and single characters
+func tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := words[:0]
+	for _, word := range words {
+		if len([]rune(word)) > 1 && !stopwords[word] {
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
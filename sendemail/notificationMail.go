@@ -0,0 +1,32 @@
+package sendemail
+
+import (
+	"bytes"
+	"fmt"
+	"net/smtp"
+)
+
+// NotificationEmail sends an HTML notification a visitor subscribed to, such as a price
+// drop. unsubscribeURL is announced in the List-Unsubscribe header so mail clients can
+// offer their own unsubscribe button.
+func NotificationEmail(to, subject, body, unsubscribeURL, emailFrom, emailPass string) error {
+	// SMTP server configuration
+	smtpHost := "smtp.gmail.com"
+	smtpPort := "587"
+
+	// Authentication
+	auth := smtp.PlainAuth("", emailFrom, emailPass, smtpHost)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", emailFrom)
+	fmt.Fprintf(&buf, "To: %s\r\n", to)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&buf, "List-Unsubscribe: <%s>\r\n", unsubscribeURL)
+	fmt.Fprintf(&buf, "List-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n")
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: text/html; charset=\"UTF-8\"\r\n\r\n")
+	fmt.Fprintf(&buf, "%s\r\n", body)
+
+	// Send email
+	return smtp.SendMail(smtpHost+":"+smtpPort, auth, emailFrom, []string{to}, buf.Bytes())
+}
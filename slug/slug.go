@@ -0,0 +1,94 @@
+package slug
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxLength is the longest slug Make will produce
+const MaxLength = 80
+
+// transliterations covers letters that do not decompose into ASCII plus a combining mark
+var transliterations = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'Æ': "ae", 'ø': "o", 'Ø': "o", 'œ': "oe", 'Œ': "oe",
+	'đ': "d", 'Đ': "d", 'ð': "d", 'Ð': "d", 'þ': "th", 'Þ': "th", 'ł': "l", 'Ł': "l",
+	'ı': "i", '&': " and ", '@': " at ",
+	// Cyrillic
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "i", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "iu",
+	'я': "ia",
+	// Greek
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i", 'θ': "th",
+	'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o", 'π': "p",
+	'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps",
+	'ω': "o",
+}
+
+var validSlug = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Make turns a title into a lowercase, hyphen separated ASCII slug.
+// Accented letters are reduced to their base letter and common non-Latin
+// letters are transliterated; anything else becomes a separator.
+func Make(title string) string {
+	var b strings.Builder
+	for _, r := range norm.NFKD.String(strings.ToLower(title)) {
+		if unicode.Is(unicode.Mn, r) {
+			// Drop combining marks left over from decomposing accented letters
+			continue
+		}
+		if t, ok := transliterations[r]; ok {
+			b.WriteString(t)
+			continue
+		}
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+			continue
+		}
+		b.WriteByte('-')
+	}
+
+	parts := strings.FieldsFunc(b.String(), func(r rune) bool {
+		return r == '-' || r == ' '
+	})
+
+	slug := ""
+	for _, part := range parts {
+		next := part
+		if slug != "" {
+			next = slug + "-" + part
+		}
+		if len(next) > MaxLength {
+			break
+		}
+		slug = next
+	}
+	if slug == "" && len(parts) > 0 {
+		slug = parts[0][:MaxLength]
+	}
+	return slug
+}
+
+// WithSuffix returns the n-th candidate for a slug that is taken: base itself for 1, then
+// base-2, base-3, ... Base is shortened to make room for the suffix, without leaving a
+// hyphen before it.
+func WithSuffix(base string, n int) string {
+	if n <= 1 {
+		return base
+	}
+	suffix := "-" + strconv.Itoa(n)
+	if len(base)+len(suffix) > MaxLength {
+		base = strings.TrimRight(base[:MaxLength-len(suffix)], "-")
+	}
+	return base + suffix
+}
+
+// Valid reports whether s is already a well-formed slug
+func Valid(s string) bool {
+	return len(s) <= MaxLength && validSlug.MatchString(s)
+}
@@ -0,0 +1,106 @@
+package slug
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Summer Dress", "summer-dress"},
+		{"  Summer   Dress!  ", "summer-dress"},
+		{"Linen-shirt -- blue", "linen-shirt-blue"},
+		{"Size 38/40", "size-38-40"},
+		// Accents are dropped from letters that decompose
+		{"Café Crème Brûlée", "cafe-creme-brulee"},
+		{"Åre Ängel Östersund", "are-angel-ostersund"},
+		{"Fullwidth ＡＢＣ", "fullwidth-abc"},
+		// Letters that do not decompose are transliterated
+		{"Straße", "strasse"},
+		{"Smørrebrød", "smorrebrod"},
+		{"Æblegrød & Œuvre", "aeblegrod-and-oeuvre"},
+		{"Łódź", "lodz"},
+		{"Þórður", "thordur"},
+		{"Hello @ home", "hello-at-home"},
+		{"Платье", "plate"},
+		{"Щука", "shchuka"},
+		{"Ψάρι", "psari"},
+		// Anything else is a separator
+		{"Emoji 👗 dress", "emoji-dress"},
+		{"日本", ""},
+		{"!!!", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := Make(test.title); got != test.want {
+			t.Errorf("Make(%q) = %q, want %q", test.title, got, test.want)
+		}
+	}
+}
+
+func TestMakeTruncatesAtWords(t *testing.T) {
+	title := strings.Repeat("abcdefghi ", 20)
+	got := Make(title)
+	if len(got) > MaxLength {
+		t.Fatalf("%q is %d long", got, len(got))
+	}
+	// Eight words of nine letters and their hyphens fill 79 characters
+	if want := strings.TrimSuffix(strings.Repeat("abcdefghi-", 8), "-"); got != want {
+		t.Errorf("Make = %q, want %q", got, want)
+	}
+	if !Valid(got) {
+		t.Errorf("%q is not a valid slug", got)
+	}
+
+	// A single word longer than MaxLength is cut
+	long := strings.Repeat("a", MaxLength+20)
+	if got := Make(long); got != long[:MaxLength] {
+		t.Errorf("Make(long word) = %q", got)
+	}
+}
+
+func TestWithSuffix(t *testing.T) {
+	long := strings.Repeat("a", MaxLength)
+	// The cut would end on the hyphen between the words
+	hyphenAtCut := strings.Repeat("a", MaxLength-3) + "-bb"
+
+	tests := []struct {
+		base string
+		n    int
+		want string
+	}{
+		{"dress", 1, "dress"},
+		{"dress", 2, "dress-2"},
+		{"dress", 17, "dress-17"},
+		{long, 1, long},
+		{long, 2, long[:MaxLength-2] + "-2"},
+		{long, 100, long[:MaxLength-4] + "-100"},
+		{hyphenAtCut, 2, strings.Repeat("a", MaxLength-3) + "-2"},
+		{hyphenAtCut, 10, strings.Repeat("a", MaxLength-3) + "-10"},
+	}
+	for _, test := range tests {
+		got := WithSuffix(test.base, test.n)
+		if got != test.want {
+			t.Errorf("WithSuffix(%q, %d) = %q, want %q", test.base, test.n, got, test.want)
+		}
+		if !Valid(got) {
+			t.Errorf("WithSuffix(%q, %d) = %q is not a valid slug", test.base, test.n, got)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	for _, s := range []string{"a", "summer-dress", "size-38", strings.Repeat("a", MaxLength)} {
+		if !Valid(s) {
+			t.Errorf("Valid(%q) = false", s)
+		}
+	}
+	for _, s := range []string{"", "-a", "a-", "a--b", "Summer", "a b", "café", strings.Repeat("a", MaxLength+1)} {
+		if Valid(s) {
+			t.Errorf("Valid(%q) = true", s)
+		}
+	}
+}
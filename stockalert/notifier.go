@@ -0,0 +1,133 @@
+package stockalert
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"minna-style-hub/database"
+	"minna-style-hub/sendemail"
+	"os"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxAttempts is how often sending a notification is tried before it is dropped
+const maxAttempts = 5
+
+// wake lets Notify start a run without waiting for the next tick
+var wake = make(chan struct{}, 1)
+
+// Notify asks the running sender to process the queue now. It never blocks.
+func Notify() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// RunOnce sends every queued back-in-stock notification. Notifications of items that ran
+// out again are put back to wait for the next restock, those of deleted items are dropped.
+// Links in the emails point to baseURL, the public address of the API.
+func RunOnce(ctx context.Context, baseURL string) error {
+	emailFrom := os.Getenv("EMAIL_FROM")
+	emailPass := os.Getenv("EMAIL_PASSWORD")
+	if emailFrom == "" || emailPass == "" {
+		return fmt.Errorf("EMAIL_FROM or EMAIL_PASSWORD not set")
+	}
+
+	sent := 0
+	for ctx.Err() == nil {
+		sub, found, err := database.ClaimStockNotification()
+		if err != nil {
+			return err
+		}
+		if !found {
+			break
+		}
+
+		item, err := database.GetItem(sub.ItemID)
+		if err == mongo.ErrNoDocuments {
+			if err := database.CompleteStockNotification(sub.ID); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if item.OutOfStock {
+			if err := database.UnqueueStockNotification(sub.ID); err != nil {
+				return err
+			}
+			continue
+		}
+
+		title := strings.Join(strings.Fields(item.Title), " ")
+		unsubscribeURL := baseURL + "/stock-alerts/" + sub.Token + "/unsubscribe"
+		body := fmt.Sprintf("<p><strong>%s</strong> is back in stock.</p>", html.EscapeString(title))
+		if item.ButtonLink != "" {
+			body += fmt.Sprintf("<p><a href=\"%s/go/%s\">View the item</a></p>", baseURL, item.ID)
+		}
+		body += fmt.Sprintf("<p>You will not get further emails about this item. <a href=\"%s\">Unsubscribe</a></p>", unsubscribeURL)
+
+		subject := fmt.Sprintf("Back in stock: %s", title)
+		if err := sendemail.NotificationEmail(sub.Email, subject, body, unsubscribeURL, emailFrom, emailPass); err != nil {
+			log.Println("Error sending back-in-stock email:", err)
+			if err := database.FailStockNotification(sub.ID, maxAttempts); err != nil {
+				return err
+			}
+			// Leave the rest of the queue for the next run instead of hammering a failing server
+			break
+		}
+		if err := database.CompleteStockNotification(sub.ID); err != nil {
+			return err
+		}
+		sent++
+	}
+
+	if sent > 0 {
+		log.Printf("Sent %d back-in-stock notifications", sent)
+	}
+	return nil
+}
+
+// Start processes the notification queue every interval and whenever Notify is called,
+// until ctx is cancelled
+func Start(ctx context.Context, interval time.Duration, baseURL string) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := RunOnce(ctx, baseURL); err != nil {
+			log.Println("Error sending back-in-stock notifications:", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// FromEnv returns STOCK_ALERT_INTERVAL (default 1m), the time between queue runs, and
+// STOCK_ALERT_TTL (default 720h), how long a subscription lasts before it expires
+func FromEnv() (interval, ttl time.Duration) {
+	return envDuration("STOCK_ALERT_INTERVAL", time.Minute), envDuration("STOCK_ALERT_TTL", 30*24*time.Hour)
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		log.Printf("Invalid %s %q, using %s", name, value, fallback)
+		return fallback
+	}
+	return parsed
+}
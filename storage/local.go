@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Local stores objects as files below Root
+type Local struct {
+	Root string
+}
+
+// NewLocal returns a Local storage rooted at dir, creating the directory when needed
+func NewLocal(dir string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Local{Root: dir}, nil
+}
+
+// path maps a key to a file below Root, rejecting keys that would escape it
+func (l *Local) path(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if cleaned == "/" || cleaned != "/"+key || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("storage: invalid key %q", key)
+	}
+	return filepath.Join(l.Root, filepath.FromSlash(cleaned)), nil
+}
+
+// Put writes the object to a temporary file first, so readers never see a partial file
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// Get opens the file of the object
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	name, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+// Delete removes the file of the object
+func (l *Local) Delete(ctx context.Context, key string) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// List walks the files below Root. Temporary files of writes in progress are skipped.
+func (l *Local) List(ctx context.Context, prefix string, fn func(Object) error) error {
+	err := filepath.WalkDir(l.Root, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		rel, err := filepath.Rel(l.Root, name)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+
+		if entry.IsDir() {
+			// Only descend into directories that may hold keys with the prefix
+			if key != "." && !strings.HasPrefix(key+"/", prefix) && !strings.HasPrefix(prefix, key+"/") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasPrefix(key, prefix) || strings.HasPrefix(entry.Name(), ".upload-") {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return fn(Object{Key: key, Size: info.Size(), LastModified: info.ModTime()})
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
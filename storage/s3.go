@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3Config configures an S3 storage. Endpoint defaults to AWS for Region; set it and
+// PathStyle to use an S3 compatible service such as MinIO.
+type S3Config struct {
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	// PathStyle addresses the bucket as the first path segment instead of a subdomain
+	PathStyle bool
+}
+
+// S3 stores objects in a bucket of Amazon S3 or a service compatible with its API
+type S3 struct {
+	endpoint  *url.URL
+	bucket    string
+	pathStyle bool
+	signer    signer
+	client    *http.Client
+}
+
+// NewS3 returns an S3 storage for the bucket described by config
+func NewS3(config S3Config) (*S3, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("storage: missing S3 bucket")
+	}
+	if config.AccessKey == "" || config.SecretKey == "" {
+		return nil, fmt.Errorf("storage: missing S3 credentials")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "https://s3." + config.Region + ".amazonaws.com"
+	}
+
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("storage: invalid S3 endpoint %q", config.Endpoint)
+	}
+
+	return &S3{
+		endpoint:  endpoint,
+		bucket:    config.Bucket,
+		pathStyle: config.PathStyle,
+		signer: signer{
+			accessKey: config.AccessKey,
+			secretKey: config.SecretKey,
+			region:    config.Region,
+			service:   "s3",
+		},
+		client: &http.Client{Timeout: 60 * time.Second},
+	}, nil
+}
+
+// objectURL returns the URL of the object stored under key
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	p := strings.TrimSuffix(u.Path, "/") + "/" + key
+	if s.pathStyle {
+		p = strings.TrimSuffix(u.Path, "/") + "/" + s.bucket + "/" + key
+	} else {
+		u.Host = s.bucket + "." + u.Host
+	}
+	u.Path = p
+	// Keys are encoded the way the signature expects, not the way net/url would
+	u.RawPath = canonicalPath(p)
+	return &u
+}
+
+// do signs and sends a request for the object stored under key, or for the bucket when key is empty
+func (s *S3) do(ctx context.Context, method, key string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	u := s.objectURL(key)
+	u.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	payloadHash := emptyPayloadHash
+	if body != nil {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	} else {
+		req.Body = http.NoBody
+		req.ContentLength = 0
+	}
+	s.signer.sign(req, payloadHash, time.Now().UTC())
+
+	return s.client.Do(req)
+}
+
+// responseError describes an unexpected response, including the start of the error document
+func responseError(method, key string, resp *http.Response) error {
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("storage: S3 %s %s: %s: %s", method, key, resp.Status, bytes.TrimSpace(detail))
+}
+
+// Put uploads the object. S3 needs the length and the hash of the body up front, so
+// the content is read into memory first; stored objects are bounded by the upload limits.
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		data = []byte{}
+	}
+
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	resp, err := s.do(ctx, http.MethodPut, key, nil, data, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(http.MethodPut, key, resp)
+	}
+	return nil
+}
+
+// Get downloads the object
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	defer resp.Body.Close()
+	return nil, responseError(http.MethodGet, key, resp)
+}
+
+// Delete removes the object
+func (s *S3) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNoContent, http.StatusOK, http.StatusNotFound:
+		return nil
+	}
+	return responseError(http.MethodDelete, key, resp)
+}
+
+// listResult is the part of a ListObjectsV2 response that List uses
+type listResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List pages through the objects of the bucket with ListObjectsV2
+func (s *S3) List(ctx context.Context, prefix string, fn func(Object) error) error {
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := responseError(http.MethodGet, "?list-type=2", resp)
+			resp.Body.Close()
+			return err
+		}
+
+		var page listResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, object := range page.Contents {
+			if err := fn(Object{Key: object.Key, Size: object.Size, LastModified: object.LastModified}); err != nil {
+				return err
+			}
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// PresignPut returns a URL that allows uploading the object with a PUT request until
+// expires has passed. The request must send exactly the given content type and length,
+// and the bucket needs a CORS rule allowing PUT from the site for browsers to use it.
+func (s *S3) PresignPut(ctx context.Context, key, contentType string, size int64, expires time.Duration) (string, error) {
+	headers := map[string]string{
+		"Content-Type":   contentType,
+		"Content-Length": fmt.Sprint(size),
+	}
+	return s.signer.presign(http.MethodPut, s.objectURL(key), headers, time.Now().UTC(), expires).String(), nil
+}
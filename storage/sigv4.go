@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AWS Signature Version 4 as used by S3 and the services compatible with it, see
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-authenticating-requests.html
+
+const (
+	sigAlgorithm     = "AWS4-HMAC-SHA256"
+	sigTimeFormat    = "20060102T150405Z"
+	sigDateFormat    = "20060102"
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// signer signs requests for one region and service with a static key pair
+type signer struct {
+	accessKey string
+	secretKey string
+	region    string
+	service   string
+}
+
+// scope returns the credential scope of requests signed on the day of t
+func (s signer) scope(t time.Time) string {
+	return t.Format(sigDateFormat) + "/" + s.region + "/" + s.service + "/aws4_request"
+}
+
+// signature returns the hex signature of a canonical request made at t
+func (s signer) signature(t time.Time, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := sigAlgorithm + "\n" + t.Format(sigTimeFormat) + "\n" + s.scope(t) + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), t.Format(sigDateFormat))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s.service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// sign adds the Authorization header to req. payloadHash is the hex SHA-256 of the body.
+func (s signer) sign(req *http.Request, payloadHash string, t time.Time) {
+	req.Header.Set("X-Amz-Date", t.Format(sigTimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || lower == "content-md5" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	canonicalHeaders, signedHeaders := canonicalHeaderList(headers)
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath(req.URL.Path),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	req.Header.Set("Authorization", sigAlgorithm+
+		" Credential="+s.accessKey+"/"+s.scope(t)+
+		", SignedHeaders="+signedHeaders+
+		", Signature="+s.signature(t, canonicalRequest))
+}
+
+// presign returns u with the query parameters that authorize a request with method and
+// the given headers until expires has passed. The payload is not signed.
+func (s signer) presign(method string, u *url.URL, headers map[string]string, t time.Time, expires time.Duration) *url.URL {
+	signed := map[string]string{"host": u.Host}
+	for name, value := range headers {
+		signed[strings.ToLower(name)] = strings.TrimSpace(value)
+	}
+	canonicalHeaders, signedHeaders := canonicalHeaderList(signed)
+
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", sigAlgorithm)
+	query.Set("X-Amz-Credential", s.accessKey+"/"+s.scope(t))
+	query.Set("X-Amz-Date", t.Format(sigTimeFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires/time.Second)))
+	query.Set("X-Amz-SignedHeaders", signedHeaders)
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		canonicalPath(u.Path),
+		canonicalQuery(query),
+		canonicalHeaders,
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+	query.Set("X-Amz-Signature", s.signature(t, canonicalRequest))
+
+	presigned := *u
+	presigned.RawQuery = canonicalQuery(query)
+	return &presigned
+}
+
+// canonicalHeaderList returns the canonical headers block and the signed headers list
+func canonicalHeaderList(headers map[string]string) (string, string) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var block strings.Builder
+	for _, name := range names {
+		block.WriteString(name + ":" + headers[name] + "\n")
+	}
+	return block.String(), strings.Join(names, ";")
+}
+
+// canonicalPath URI encodes every segment of an object path. S3 paths are encoded once.
+func canonicalPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQuery encodes the query sorted by encoded name, then value
+func canonicalQuery(query url.Values) string {
+	encoded := make(map[string][]string, len(query))
+	names := make([]string, 0, len(query))
+	for name, values := range query {
+		key := uriEncode(name)
+		names = append(names, key)
+		for _, value := range values {
+			encoded[key] = append(encoded[key], uriEncode(value))
+		}
+		sort.Strings(encoded[key])
+	}
+	sort.Strings(names)
+
+	var pairs []string
+	for _, name := range names {
+		for _, value := range encoded[name] {
+			pairs = append(pairs, name+"="+value)
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes everything but the unreserved characters of RFC 3986
+func uriEncode(s string) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hexDigits[c>>4])
+		b.WriteByte(hexDigits[c&15])
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
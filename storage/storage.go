@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrNotFound is returned when no object is stored under a key
+var ErrNotFound = errors.New("storage: object not found")
+
+// Storage keeps blobs such as uploaded images under slash separated keys
+type Storage interface {
+	// Put stores the content of r under key, replacing any existing object
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	// Get opens the object stored under key, returning ErrNotFound when there is none
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object stored under key. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+	// List calls fn for every object whose key starts with prefix, stopping at the first error
+	List(ctx context.Context, prefix string, fn func(Object) error) error
+}
+
+// Object describes a stored object as returned by List
+type Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// Presigner is implemented by storages that let clients upload directly, without
+// sending the content through this server
+type Presigner interface {
+	// PresignPut returns a URL that accepts a PUT of an object with exactly the given
+	// content type and size under key until expires has passed
+	PresignPut(ctx context.Context, key, contentType string, size int64, expires time.Duration) (string, error)
+}
+
+var backend Storage
+
+// Configure sets up the storage backend chosen by STORAGE_BACKEND:
+//
+//	local  (default) files below UPLOAD_DIR (default "uploads")
+//	s3     the bucket S3_BUCKET in S3_REGION (default "us-east-1") using S3_ACCESS_KEY_ID
+//	       and S3_SECRET_ACCESS_KEY (or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY).
+//	       S3_ENDPOINT selects an S3 compatible service and S3_FORCE_PATH_STYLE=true
+//	       addresses the bucket in the path, as MinIO expects.
+//
+// Local files are lost when a host such as Netlify redeploys, so hosted sites use s3.
+func Configure() error {
+	switch name := os.Getenv("STORAGE_BACKEND"); name {
+	case "", "local":
+		dir := os.Getenv("UPLOAD_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		local, err := NewLocal(dir)
+		if err != nil {
+			return err
+		}
+		backend = local
+		return nil
+	case "s3":
+		s3, err := NewS3(S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Region:    os.Getenv("S3_REGION"),
+			AccessKey: envFirst("S3_ACCESS_KEY_ID", "AWS_ACCESS_KEY_ID"),
+			SecretKey: envFirst("S3_SECRET_ACCESS_KEY", "AWS_SECRET_ACCESS_KEY"),
+			PathStyle: os.Getenv("S3_FORCE_PATH_STYLE") == "true",
+		})
+		if err != nil {
+			return err
+		}
+		backend = s3
+		return nil
+	default:
+		return fmt.Errorf("unknown STORAGE_BACKEND %q", name)
+	}
+}
+
+// Current returns the configured storage backend
+func Current() Storage {
+	return backend
+}
+
+// envFirst returns the first of the environment variables that is set
+func envFirst(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,305 @@
+package validation
+
+import (
+	"fmt"
+	"minna-style-hub/locale"
+	"net/mail"
+	"net/url"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError describes a single invalid field using its JSON name
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors is a list of field errors returned by Struct and Partial
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, fieldErr := range e {
+		messages[i] = fieldErr.Field + ": " + fieldErr.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// imageExtensions lists the file extensions accepted by the "image" rule
+var imageExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+	".webp": true,
+	".avif": true,
+	".svg":  false, // SVG can carry scripts
+}
+
+// Struct validates every field of v according to its `validate` struct tag.
+//
+// Supported rules, separated by commas:
+//
+//	required       value must not be empty
+//	min=N, max=N   length bounds for strings (in characters) and slices, value bounds for numbers
+//	oneof=a|b      string must be one of the listed values (empty is allowed unless required)
+//	url            absolute http or https URL
+//	image          url whose path, when it has an extension, names a raster image
+//	email          plain email address
+//	keys=a|b       every key of a map must be one of the listed values
+//	locales        every key of a map must be one of locale.Supported
+//	dive           apply the remaining rules to every element of a slice or map;
+//	               struct elements, and struct fields, are validated through their own tags
+func Struct(v interface{}) Errors {
+	return validate(v, nil)
+}
+
+// Partial validates only the fields of v whose JSON names are listed
+func Partial(v interface{}, fields []string) Errors {
+	only := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		only[field] = true
+	}
+	return validate(v, only)
+}
+
+func validate(v interface{}, only map[string]bool) Errors {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var errs Errors
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		rules := field.Tag.Get("validate")
+		if rules == "" || !field.IsExported() {
+			continue
+		}
+
+		name := JSONName(field)
+		if only != nil && !only[name] {
+			continue
+		}
+
+		if msg := check(value.Field(i), strings.Split(rules, ","), name, &errs); msg != "" {
+			errs = append(errs, FieldError{Field: name, Message: msg})
+		}
+	}
+	return errs
+}
+
+// JSONName returns the name a struct field has once encoded to JSON
+func JSONName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// check applies rules to value and returns the first failure. Errors found on slice
+// elements through "dive" are appended to errs directly using indexed field names.
+func check(value reflect.Value, rules []string, name string, errs *Errors) string {
+	for i, rule := range rules {
+		key, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+
+		if key == "dive" {
+			switch value.Kind() {
+			case reflect.Slice:
+				for j := 0; j < value.Len(); j++ {
+					diveInto(value.Index(j), rules[i+1:], fmt.Sprintf("%s[%d]", name, j), errs)
+				}
+			case reflect.Map:
+				keys := value.MapKeys()
+				sort.Slice(keys, func(a, b int) bool { return keys[a].String() < keys[b].String() })
+				for _, mapKey := range keys {
+					diveInto(value.MapIndex(mapKey), rules[i+1:], name+"."+mapKey.String(), errs)
+				}
+			case reflect.Struct, reflect.Ptr:
+				if value.Kind() == reflect.Struct || !value.IsNil() {
+					diveInto(value, rules[i+1:], name, errs)
+				}
+			}
+			return ""
+		}
+
+		if msg := applyRule(value, key, arg); msg != "" {
+			return msg
+		}
+	}
+	return ""
+}
+
+// diveInto validates one slice or map element. Struct elements are validated
+// through their own tags with field names prefixed by name.
+func diveInto(elem reflect.Value, rules []string, name string, errs *Errors) {
+	if reflect.Indirect(elem).Kind() == reflect.Struct {
+		for _, nested := range validate(elem.Interface(), nil) {
+			*errs = append(*errs, FieldError{Field: name + "." + nested.Field, Message: nested.Message})
+		}
+	}
+	if msg := check(elem, rules, name, errs); msg != "" {
+		*errs = append(*errs, FieldError{Field: name, Message: msg})
+	}
+}
+
+func applyRule(value reflect.Value, key, arg string) string {
+	str := ""
+	if value.Kind() == reflect.String {
+		str = strings.TrimSpace(value.String())
+	}
+
+	switch key {
+	case "required":
+		if isEmpty(value) {
+			return "is required"
+		}
+	case "min", "max":
+		if number, ok := numeric(value); ok {
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return ""
+			}
+			if key == "min" && number < limit {
+				return fmt.Sprintf("must be at least %s", arg)
+			}
+			if key == "max" && number > limit {
+				return fmt.Sprintf("must be at most %s", arg)
+			}
+			return ""
+		}
+		limit, err := strconv.Atoi(arg)
+		if err != nil {
+			return ""
+		}
+		n := length(value)
+		if key == "min" && n < limit && !isEmpty(value) {
+			return fmt.Sprintf("must be at least %d long", limit)
+		}
+		if key == "max" && n > limit {
+			return fmt.Sprintf("must be at most %d long", limit)
+		}
+	case "keys", "locales":
+		if value.Kind() != reflect.Map {
+			return ""
+		}
+		allowed := locale.Supported
+		if key == "keys" {
+			allowed = strings.Split(arg, "|")
+		}
+		for _, mapKey := range value.MapKeys() {
+			if !contains(allowed, mapKey.String()) {
+				return fmt.Sprintf("has unsupported key %q, expected one of %s", mapKey.String(), strings.Join(allowed, ", "))
+			}
+		}
+	case "oneof":
+		if str == "" {
+			return ""
+		}
+		if contains(strings.Split(arg, "|"), str) {
+			return ""
+		}
+		return "must be one of " + strings.ReplaceAll(arg, "|", ", ")
+	case "url":
+		if str != "" && !isHTTPURL(str) {
+			return "must be an absolute http or https URL"
+		}
+	case "image":
+		if str == "" {
+			return ""
+		}
+		if !isHTTPURL(str) {
+			return "must be an absolute http or https URL"
+		}
+		if !isImagePath(str) {
+			return "must point to a jpg, png, gif, webp or avif image"
+		}
+	case "email":
+		if str != "" && !isEmail(str) {
+			return "must be a valid email address"
+		}
+	}
+	return ""
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func isEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(value.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return value.IsNil()
+	}
+	return value.IsZero()
+}
+
+// numeric returns the value of integer and floating point fields
+func numeric(value reflect.Value) (float64, bool) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	}
+	return 0, false
+}
+
+func length(value reflect.Value) int {
+	switch value.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(value.String())
+	case reflect.Slice, reflect.Map:
+		return value.Len()
+	}
+	return 0
+}
+
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	scheme := strings.ToLower(u.Scheme)
+	return (scheme == "http" || scheme == "https") && u.Host != ""
+}
+
+func isImagePath(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	ext := strings.ToLower(path.Ext(u.Path))
+	if ext == "" {
+		// CDNs frequently serve images from extensionless paths
+		return true
+	}
+	return imageExtensions[ext]
+}
+
+func isEmail(raw string) bool {
+	addr, err := mail.ParseAddress(raw)
+	if err != nil || addr.Address != raw {
+		return false
+	}
+	at := strings.LastIndex(raw, "@")
+	return at > 0 && strings.Contains(raw[at+1:], ".")
+}
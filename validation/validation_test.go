@@ -0,0 +1,243 @@
+package validation
+
+import (
+	"minna-style-hub/locale"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// messages returns the errors as a field to message map for comparison
+func messages(errs Errors) map[string]string {
+	out := make(map[string]string, len(errs))
+	for _, err := range errs {
+		out[err.Field] = err.Message
+	}
+	return out
+}
+
+func checkErrors(t *testing.T, name string, errs Errors, want map[string]string) {
+	t.Helper()
+	if want == nil {
+		want = map[string]string{}
+	}
+	if got := messages(errs); !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: errors %v, want %v", name, got, want)
+	}
+}
+
+func TestRequired(t *testing.T) {
+	type value struct {
+		Name   string            `json:"name" validate:"required"`
+		Tags   []string          `json:"tags" validate:"required"`
+		Labels map[string]string `json:"labels" validate:"required"`
+		Price  float64           `json:"price" validate:"required"`
+		Parent *struct{}         `json:"parent" validate:"required"`
+	}
+
+	checkErrors(t, "empty", Struct(value{Name: "  "}), map[string]string{
+		"name":   "is required",
+		"tags":   "is required",
+		"labels": "is required",
+		"price":  "is required",
+		"parent": "is required",
+	})
+	checkErrors(t, "set", Struct(value{
+		Name:   "a",
+		Tags:   []string{""},
+		Labels: map[string]string{"a": ""},
+		Price:  0.5,
+		Parent: &struct{}{},
+	}), nil)
+}
+
+func TestMinMax(t *testing.T) {
+	type value struct {
+		Name  string   `json:"name" validate:"min=2,max=4"`
+		Tags  []string `json:"tags" validate:"max=2"`
+		Price float64  `json:"price" validate:"min=0,max=10.5"`
+		Count int      `json:"count" validate:"min=1"`
+	}
+
+	tests := []struct {
+		name  string
+		value value
+		want  map[string]string
+	}{
+		{name: "within bounds", value: value{Name: "abcd", Tags: []string{"a", "b"}, Price: 10.5, Count: 1}},
+		// An empty string is left to the required rule
+		{name: "empty string", value: value{Count: 1}},
+		// Lengths are counted in characters, not bytes
+		{name: "multibyte", value: value{Name: "åäöü", Count: 1}},
+		{name: "too short", value: value{Name: "a", Count: 1}, want: map[string]string{"name": "must be at least 2 long"}},
+		{name: "too long", value: value{Name: "abcde", Tags: []string{"a", "b", "c"}, Count: 1}, want: map[string]string{
+			"name": "must be at most 4 long",
+			"tags": "must be at most 2 long",
+		}},
+		{name: "numbers out of range", value: value{Price: -1, Count: 0}, want: map[string]string{
+			"price": "must be at least 0",
+			"count": "must be at least 1",
+		}},
+		{name: "fraction above max", value: value{Price: 10.51, Count: 1}, want: map[string]string{"price": "must be at most 10.5"}},
+	}
+	for _, test := range tests {
+		checkErrors(t, test.name, Struct(test.value), test.want)
+	}
+}
+
+func TestOneOf(t *testing.T) {
+	type value struct {
+		Status string `json:"status" validate:"oneof=draft|published"`
+	}
+
+	for _, status := range []string{"", "draft", "published"} {
+		checkErrors(t, status, Struct(value{status}), nil)
+	}
+	checkErrors(t, "unknown", Struct(value{"deleted"}), map[string]string{"status": "must be one of draft, published"})
+	checkErrors(t, "case", Struct(value{"Draft"}), map[string]string{"status": "must be one of draft, published"})
+}
+
+func TestURL(t *testing.T) {
+	type value struct {
+		Link string `json:"link" validate:"url"`
+	}
+
+	for _, link := range []string{"", "http://example.com", "https://example.com/a?b=c", "HTTPS://EXAMPLE.COM"} {
+		checkErrors(t, link, Struct(value{link}), nil)
+	}
+	for _, link := range []string{"example.com", "/relative", "ftp://example.com", "javascript:alert(1)", "http://", "http://exa mple.com"} {
+		checkErrors(t, link, Struct(value{link}), map[string]string{"link": "must be an absolute http or https URL"})
+	}
+}
+
+func TestImage(t *testing.T) {
+	type value struct {
+		Src string `json:"src" validate:"image"`
+	}
+
+	valid := []string{
+		"",
+		"https://cdn.example.com/a.jpg",
+		"https://cdn.example.com/a.JPEG?w=200",
+		"https://cdn.example.com/a.webp",
+		"https://cdn.example.com/a.avif",
+		// Extensionless paths are common on CDNs
+		"https://cdn.example.com/images/12345",
+	}
+	for _, src := range valid {
+		checkErrors(t, src, Struct(value{src}), nil)
+	}
+
+	checkErrors(t, "not a URL", Struct(value{"a.jpg"}), map[string]string{"src": "must be an absolute http or https URL"})
+	for _, src := range []string{"https://cdn.example.com/a.svg", "https://cdn.example.com/a.html", "https://cdn.example.com/a.pdf"} {
+		checkErrors(t, src, Struct(value{src}), map[string]string{"src": "must point to a jpg, png, gif, webp or avif image"})
+	}
+}
+
+func TestEmail(t *testing.T) {
+	type value struct {
+		Email string `json:"email" validate:"email"`
+	}
+
+	for _, email := range []string{"", "a@example.com", "first.last+tag@mail.example.se"} {
+		checkErrors(t, email, Struct(value{email}), nil)
+	}
+	for _, email := range []string{"a", "a@", "@example.com", "a@localhost", "Name <a@example.com>", "a@example.com, b@example.com"} {
+		checkErrors(t, email, Struct(value{email}), map[string]string{"email": "must be a valid email address"})
+	}
+}
+
+func TestKeys(t *testing.T) {
+	type value struct {
+		Labels map[string]string `json:"labels" validate:"keys=a|b"`
+	}
+
+	checkErrors(t, "allowed", Struct(value{map[string]string{"a": "x", "b": "y"}}), nil)
+	checkErrors(t, "unknown", Struct(value{map[string]string{"a": "x", "c": "y"}}), map[string]string{
+		"labels": `has unsupported key "c", expected one of a, b`,
+	})
+}
+
+func TestLocales(t *testing.T) {
+	type value struct {
+		Alt map[string]string `json:"alt" validate:"locales"`
+	}
+
+	// Every supported locale is accepted, whatever the list holds
+	alt := map[string]string{}
+	for _, loc := range locale.Supported {
+		alt[loc] = "text"
+	}
+	checkErrors(t, "supported", Struct(value{alt}), nil)
+
+	errs := Struct(value{map[string]string{"xx": "text"}})
+	want := `has unsupported key "xx", expected one of ` + strings.Join(locale.Supported, ", ")
+	checkErrors(t, "unsupported", errs, map[string]string{"alt": want})
+}
+
+func TestDive(t *testing.T) {
+	type point struct {
+		X float64 `json:"x" validate:"min=0,max=1"`
+	}
+	type translation struct {
+		Title string `json:"title" validate:"required,max=3"`
+	}
+	type value struct {
+		Tags         []string               `json:"tags" validate:"max=3,dive,required,max=2"`
+		Alt          map[string]string      `json:"alt" validate:"keys=en|sv,dive,max=2"`
+		Points       []point                `json:"points" validate:"dive"`
+		Focus        *point                 `json:"focus" validate:"dive"`
+		Translations map[string]translation `json:"translations" validate:"dive"`
+	}
+
+	checkErrors(t, "valid", Struct(value{
+		Tags:         []string{"a", "bc"},
+		Alt:          map[string]string{"en": "ab"},
+		Points:       []point{{0}, {1}},
+		Translations: map[string]translation{"sv": {"abc"}},
+	}), nil)
+
+	checkErrors(t, "invalid elements", Struct(value{
+		Tags:         []string{"a", "", "abc"},
+		Alt:          map[string]string{"en": "abc", "sv": "ab"},
+		Points:       []point{{0.5}, {2}},
+		Focus:        &point{-1},
+		Translations: map[string]translation{"en": {""}, "sv": {"abcd"}},
+	}), map[string]string{
+		"tags[1]":               "is required",
+		"tags[2]":               "must be at most 2 long",
+		"alt.en":                "must be at most 2 long",
+		"points[1].x":           "must be at most 1",
+		"focus.x":               "must be at least 0",
+		"translations.en.title": "is required",
+		"translations.sv.title": "must be at most 3 long",
+	})
+
+	// Rules before dive apply to the whole collection and keep its elements from being checked
+	checkErrors(t, "rules before dive", Struct(value{
+		Tags: []string{"a", "b", "c", "toolong"},
+		Alt:  map[string]string{"de": "toolong"},
+	}), map[string]string{
+		"tags": "must be at most 3 long",
+		"alt":  `has unsupported key "de", expected one of en, sv`,
+	})
+}
+
+func TestPartial(t *testing.T) {
+	type value struct {
+		Name  string `json:"name" validate:"required"`
+		Email string `json:"email" validate:"required,email"`
+	}
+
+	checkErrors(t, "only email", Partial(value{Email: "nope"}, []string{"email"}), map[string]string{
+		"email": "must be a valid email address",
+	})
+	checkErrors(t, "nothing", Partial(value{}, nil), nil)
+}
+
+func TestErrorsError(t *testing.T) {
+	errs := Errors{{Field: "a", Message: "is required"}, {Field: "b", Message: "must be at most 2 long"}}
+	if got, want := errs.Error(), "a: is required; b: must be at most 2 long"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}